@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupLogger installs a JSON slog logger as the default logger, at the named
+// level (debug, info, warn or error).
+func setupLogger(levelName string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelName)); err != nil {
+		return err
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+	return nil
+}
+
+// setupGinDebugLog sends the route list and warnings gin prints in debug mode
+// to the JSON logger at debug level, instead of as plain text on stdout.
+func setupGinDebugLog() {
+	gin.DebugPrintRouteFunc = func(method, path, handler string, handlers int) {
+		slog.Debug("Registered route", "method", method, "path", path, "handler", handler, "handlers", handlers)
+	}
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)), "log", "gin")
+	}
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -2,205 +2,100 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
-	"runtime"
+	"os/signal"
+	"syscall"
 
-	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
+	"github.com/biodigitalJaz/web-kubeauth/internal/server"
 	"github.com/gin-gonic/gin"
-	"gopkg.in/yaml.v2"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
-type KubeConfig struct {
-	Contexts []struct {
-		Name    string `yaml:"name"`
-		Context struct {
-			Cluster string `yaml:"cluster"`
-			User    string `yaml:"user"`
-		} `yaml:"context"`
-	} `yaml:"contexts"`
-	Users []struct {
-		Name string `yaml:"name"`
-		User struct {
-			ClientCertificateData string `yaml:"client-certificate-data"`
-			ClientKeyData         string `yaml:"client-key-data"`
-		} `yaml:"user"`
-	} `yaml:"users"`
-	Clusters []struct {
-		Name    string `yaml:"name"`
-		Cluster struct {
-			Server                   string `yaml:"server"`
-			CertificateAuthorityData string `yaml:"certificate-authority-data"`
-		} `yaml:"cluster"`
-	} `yaml:"clusters"`
-}
-
 func main() {
-	router := gin.Default()
-
-	// Set up session store using cookies
-	store := cookie.NewStore([]byte("secret"))
-	router.Use(sessions.Sessions("mysession", store))
-
-	// Determine the correct path for the kubeconfig file across different OS
-	var kubeConfigPath string
-	if runtime.GOOS == "windows" {
-		kubeConfigPath = filepath.Join(os.Getenv("USERPROFILE"), ".kube", "config")
-	} else {
-		kubeConfigPath = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	cfg, err := server.LoadConfig(os.Getenv("CONFIG_FILE"))
+	if logErr := setupLogger(cfg.LogLevel); logErr != nil {
+		fatal("Invalid log level", "value", cfg.LogLevel, "error", logErr)
 	}
-
-	// Try to read the kubeconfig file
-	kubeConfigBytes, err := os.ReadFile(kubeConfigPath)
 	if err != nil {
-		log.Printf("Warning: Failed to read kubeconfig file: %v. Proceeding without kubeconfig.", err)
-		kubeConfigBytes = nil // Set to nil to handle the absence of kubeconfig
+		fatal("Invalid configuration", "error", err)
 	}
 
-	// Initialize kubeConfig variable
-	var kubeConfig KubeConfig
+	// The mode is process-wide and must be set before the router is built,
+	// debug mode prints the routes as they are registered
+	gin.SetMode(cfg.EffectiveGinMode())
+	setupGinDebugLog()
 
-	// If kubeconfig file was found, parse it
-	if kubeConfigBytes != nil {
-		err = yaml.Unmarshal(kubeConfigBytes, &kubeConfig)
-		if err != nil {
-			log.Fatalf("Failed to parse kubeconfig: %v", err)
-		}
+	s, err := server.New(cfg)
+	if err != nil {
+		fatal("Failed to set up server", "error", err)
 	}
 
-	// Display available contexts for the user to select if kubeconfig is present
-	router.GET("/", func(c *gin.Context) {
-		if kubeConfigBytes != nil && len(kubeConfig.Contexts) > 0 {
-			c.HTML(http.StatusOK, "contexts.html", gin.H{
-				"Contexts": kubeConfig.Contexts,
-			})
-		} else {
-			c.String(http.StatusOK, "No kubeconfig found or no contexts available. Application running without kubeconfig.")
-		}
-	})
-
-	// Handle context selection
-	router.POST("/select-context", func(c *gin.Context) {
-		selectedContext := c.PostForm("context")
-
-		if kubeConfigBytes == nil || len(kubeConfig.Contexts) == 0 {
-			c.String(http.StatusBadRequest, "No kubeconfig file or contexts available to select.")
-			return
-		}
-
-		// Find the selected context details
-		var selectedCluster, selectedUser string
-		for _, ctx := range kubeConfig.Contexts {
-			if ctx.Name == selectedContext {
-				selectedCluster = ctx.Context.Cluster
-				selectedUser = ctx.Context.User
-				break
-			}
-		}
-
-		// Store only minimal information in the session
-		session := sessions.Default(c)
-		session.Set("authenticated", true)
-		session.Set("user", selectedUser)
-		session.Set("cluster", selectedCluster)
-
-		err := session.Save()
+	srv := &http.Server{
+		Addr:    cfg.ListenAddr,
+		Handler: s.Handler(),
+	}
+	if cfg.ClientCAFile != "" {
+		srv.TLSConfig, err = clientCATLSConfig(cfg.ClientCAFile)
 		if err != nil {
-			log.Printf("Failed to save session: %v\n", err)
-			c.String(http.StatusInternalServerError, "Failed to save session")
-			return
-		}
-
-		c.Redirect(http.StatusFound, "/home")
-	})
-
-	// Protected route
-	router.GET("/home", func(c *gin.Context) {
-		session := sessions.Default(c)
-		auth := session.Get("authenticated")
-
-		if auth != true {
-			c.Redirect(http.StatusFound, "/")
-			return
+			fatal("Failed to load client CA", "error", err)
 		}
+	}
 
-		// Retrieve minimal data from session
-		selectedUser := session.Get("user").(string)
+	// Streams never finish on their own, end them when shutting down
+	srv.RegisterOnShutdown(s.CloseStreams)
 
-		// Use the client to create a Kubernetes clientset
-		clientConfig, err := clientcmd.NewClientConfigFromBytes(kubeConfigBytes)
-		if err != nil {
-			log.Printf("Failed to create Kubernetes client config: %v\n", err)
-			c.String(http.StatusInternalServerError, "Failed to create Kubernetes client config")
-			return
-		}
+	// Stop accepting new requests on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		restConfig, err := clientConfig.ClientConfig()
-		if err != nil {
-			log.Printf("Failed to create Kubernetes REST config: %v\n", err)
-			c.String(http.StatusInternalServerError, "Failed to create Kubernetes REST config")
-			return
-		}
+	// Pick up kubeconfig changes without a restart
+	if err := s.WatchKubeConfig(ctx); err != nil {
+		slog.Warn("Kubeconfig changes will need a restart", "error", err)
+	}
 
-		clientset, err := kubernetes.NewForConfig(restConfig)
-		if err != nil {
-			log.Printf("Failed to create Kubernetes clientset: %v\n", err)
-			c.String(http.StatusInternalServerError, "Failed to create Kubernetes clientset")
-			return
+	go func() {
+		var err error
+		if cfg.TLSEnabled() {
+			slog.Info("Listening", "addr", cfg.ListenAddr, "mode", "https", "version", server.Version)
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			slog.Info("Listening", "addr", cfg.ListenAddr, "mode", "http", "version", server.Version)
+			err = srv.ListenAndServe()
 		}
-
-		// Query for the user's ClusterRoleBindings
-		crbs, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
-			log.Printf("Failed to list ClusterRoleBindings: %v\n", err)
-			c.String(http.StatusInternalServerError, "Failed to list ClusterRoleBindings")
-			return
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server failed", "error", err)
 		}
-
-		// Check if user is part of the required ClusterRoleBinding
-		requiredRoleBinding := os.Getenv("ACCESS_ROLE") // Replace with the required ClusterRoleBinding name
-		userAuthorized := false
-
-		for _, crb := range crbs.Items {
-			for _, subject := range crb.Subjects {
-				if subject.Kind == "User" && subject.Name == selectedUser && crb.RoleRef.Name == requiredRoleBinding {
-					userAuthorized = true
-					break
-				}
-			}
-			if userAuthorized {
-				break
+	}()
+
+	// Profiling is opt-in and served on its own admin address
+	var pprofSrv *http.Server
+	if cfg.PprofAddr != "" {
+		pprofSrv = newPprofServer(cfg.PprofAddr)
+		go func() {
+			slog.Info("Serving pprof", "addr", cfg.PprofAddr)
+			if err := pprofSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("pprof server failed", "error", err)
 			}
-		}
-
-		if !userAuthorized {
-			c.String(http.StatusForbidden, "Access denied: You are not authorized to view this page.")
-			return
-		}
+		}()
+	}
 
-		// Query for RoleBindings (optional, depending on your use case)
-		rbs, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
-			log.Printf("Failed to list RoleBindings: %v\n", err)
-			c.String(http.StatusInternalServerError, "Failed to list RoleBindings")
-			return
-		}
+	<-ctx.Done()
+	stop()
 
-		// Display the home page
-		c.HTML(http.StatusOK, "home.html", gin.H{
-			"ClusterRoleBindings": crbs.Items,
-			"RoleBindings":        rbs.Items,
-		})
-	})
+	// Let in-flight requests finish within the grace period
+	slog.Info("Shutting down, waiting for active requests", "timeout", cfg.ShutdownTimeout)
 
-	// Load HTML templates
-	router.LoadHTMLGlob("templates/*")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
-	router.Run(":8080")
+	if pprofSrv != nil {
+		// Profiles are diagnostic only, don't wait for them
+		pprofSrv.Close()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fatal("Failed to shut down gracefully", "error", err)
+	}
+	slog.Info("Server stopped")
 }
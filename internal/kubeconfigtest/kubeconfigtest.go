@@ -0,0 +1,158 @@
+// Package kubeconfigtest builds kubeconfigs in code, with generated
+// certificates, so kubeconfig parsing and context selection can be exercised
+// without fixture files.
+package kubeconfigtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// DefaultValidity is how long generated certificates are valid when no
+// expiry is given.
+const DefaultValidity = 365 * 24 * time.Hour
+
+// Cluster is a cluster of a generated kubeconfig. Its CA certificate is
+// generated and self-signed.
+type Cluster struct {
+	Name   string
+	Server string
+}
+
+// User is a user of a generated kubeconfig. A user with a Token
+// authenticates with it; any other user gets a generated client certificate
+// naming them, with Groups as its organizations. CertExpiry sets when that
+// certificate expires, such as a time in the past for an expired one, and
+// defaults to DefaultValidity from now.
+type User struct {
+	Name       string
+	Token      string
+	Groups     []string
+	CertExpiry time.Time
+}
+
+// Context is a context of a generated kubeconfig, naming one of its clusters
+// and one of its users.
+type Context struct {
+	Name      string
+	Cluster   string
+	User      string
+	Namespace string
+}
+
+// Config builds a kubeconfig of clusters, users and contexts. The first
+// context is the current one.
+func Config(clusters []Cluster, users []User, contexts []Context) (*clientcmdapi.Config, error) {
+	config := clientcmdapi.NewConfig()
+
+	for _, cluster := range clusters {
+		caPEM, _, err := SelfSignedCert(cluster.Name+"-ca", nil, time.Now().Add(DefaultValidity))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the CA of cluster %s: %w", cluster.Name, err)
+		}
+		config.Clusters[cluster.Name] = &clientcmdapi.Cluster{
+			Server:                   cluster.Server,
+			CertificateAuthorityData: caPEM,
+		}
+	}
+
+	for _, user := range users {
+		authInfo := &clientcmdapi.AuthInfo{Token: user.Token}
+		if user.Token == "" {
+			expiry := user.CertExpiry
+			if expiry.IsZero() {
+				expiry = time.Now().Add(DefaultValidity)
+			}
+			certPEM, keyPEM, err := SelfSignedCert(user.Name, user.Groups, expiry)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate the certificate of user %s: %w", user.Name, err)
+			}
+			authInfo.ClientCertificateData = certPEM
+			authInfo.ClientKeyData = keyPEM
+		}
+		config.AuthInfos[user.Name] = authInfo
+	}
+
+	for _, context := range contexts {
+		if _, ok := config.Clusters[context.Cluster]; !ok {
+			return nil, fmt.Errorf("context %s names unknown cluster %s", context.Name, context.Cluster)
+		}
+		if _, ok := config.AuthInfos[context.User]; !ok {
+			return nil, fmt.Errorf("context %s names unknown user %s", context.Name, context.User)
+		}
+		config.Contexts[context.Name] = &clientcmdapi.Context{
+			Cluster:   context.Cluster,
+			AuthInfo:  context.User,
+			Namespace: context.Namespace,
+		}
+	}
+	if len(contexts) > 0 {
+		config.CurrentContext = contexts[0].Name
+	}
+
+	return config, nil
+}
+
+// YAML builds a kubeconfig as Config does and returns it as the YAML of a
+// kubeconfig file.
+func YAML(clusters []Cluster, users []User, contexts []Context) ([]byte, error) {
+	config, err := Config(clusters, users, contexts)
+	if err != nil {
+		return nil, err
+	}
+	return clientcmd.Write(*config)
+}
+
+// SelfSignedCert returns a PEM encoded self-signed certificate for
+// commonName with organizations, valid until notAfter, and its private key.
+func SelfSignedCert(commonName string, organizations []string, notAfter time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Backdated so an expiry in the past still leaves a valid period
+	notBefore := time.Now().Add(-time.Hour)
+	if notAfter.Before(notBefore) {
+		notBefore = notAfter.Add(-time.Hour)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: organizations},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// newAuditLogger returns the logger recording authorization decisions. It
+// writes JSON to stdout and, when path is set, appends to that file too.
+func newAuditLogger(path string) (*slog.Logger, error) {
+	var out io.Writer = os.Stdout
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		out = io.MultiWriter(os.Stdout, file)
+	}
+
+	// Tag every entry so audit lines can be told apart from the operational
+	// logs on stdout
+	return slog.New(slog.NewJSONHandler(out, nil)).With("log", "audit"), nil
+}
+
+// auditDecision records the authorization decision made for id.
+func (s *Server) auditDecision(id identity, result authzResult) {
+	attrs := []any{
+		"user", id.User,
+		"groups", id.Groups,
+		"context", id.Context,
+		"cluster", id.Cluster,
+		"decision", authzDecision(result.Allowed),
+	}
+	if !result.Allowed {
+		attrs = append(attrs, "reason", result.Reason)
+	}
+	if id.ImpersonatedBy != "" {
+		attrs = append(attrs, "impersonated_by", id.ImpersonatedBy)
+	}
+	if s.cfg.AccessResource != "" {
+		attrs = append(attrs, "verb", s.cfg.AccessVerb, "resource", s.cfg.AccessResource, "api_group", s.cfg.AccessAPIGroup, "resource_namespace", s.cfg.AccessNamespace, "resource_name", s.cfg.AccessName)
+	} else {
+		attrs = append(attrs, "required_roles", s.cfg.RequiredRoles, "required_bindings", s.cfg.RequiredBindings, "matched_role", result.Role, "matched_binding", result.Binding, "namespace", result.Namespace)
+	}
+	s.audit.Info("Authorization decision", attrs...)
+}
+
+// auditImpersonation records an attempt by admin to act as user.
+func (s *Server) auditImpersonation(admin identity, user string, allowed bool) {
+	s.audit.Info("Impersonation",
+		"user", admin.User,
+		"impersonated_user", user,
+		"context", admin.Context,
+		"cluster", admin.Cluster,
+		"decision", authzDecision(allowed),
+	)
+}
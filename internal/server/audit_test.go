@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAuditDecisionMatchedBinding(t *testing.T) {
+	tests := []struct {
+		name          string
+		binding       string
+		wantDecision  string
+		wantBinding   string
+		wantNamespace string
+	}{
+		{name: "ClusterRoleBinding", binding: "platform-access", wantDecision: "allow", wantBinding: "platform-access"},
+		{name: "RoleBinding", binding: "team-a/app-access", wantDecision: "allow", wantBinding: "app-access", wantNamespace: "team-a"},
+		{name: "denied", binding: "ops-access", wantDecision: "deny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(
+				clusterRoleBinding("platform-access", "view", userSubject("alice")),
+				roleBinding("team-a", "app-access", "edit", userSubject("alice")),
+			)
+			cfg := testConfig(t)
+			cfg.RequiredBindings = []string{tt.binding}
+			s := newTestServer(t, cfg, testClientsets(clientset))
+
+			var audit bytes.Buffer
+			s.audit = slog.New(slog.NewJSONHandler(&audit, nil))
+
+			id := identity{User: "alice", Kind: rbacv1.UserKind, Context: testContext}
+			if _, err := s.checkAccess(context.Background(), clientset, id); err != nil {
+				t.Fatalf("checkAccess() failed: %s", err.Message)
+			}
+
+			var record struct {
+				Decision         string   `json:"decision"`
+				RequiredBindings []string `json:"required_bindings"`
+				MatchedBinding   string   `json:"matched_binding"`
+				Namespace        string   `json:"namespace"`
+			}
+			if err := json.Unmarshal(audit.Bytes(), &record); err != nil {
+				t.Fatalf("failed to parse audit record %q: %v", audit.String(), err)
+			}
+			if record.Decision != tt.wantDecision || record.MatchedBinding != tt.wantBinding || record.Namespace != tt.wantNamespace {
+				t.Errorf("audit record %s, want decision %s, matched_binding %q and namespace %q", audit.String(), tt.wantDecision, tt.wantBinding, tt.wantNamespace)
+			}
+			if len(record.RequiredBindings) != 1 || record.RequiredBindings[0] != tt.binding {
+				t.Errorf("audit record has required_bindings %q, want %q", record.RequiredBindings, tt.binding)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers naming the authorized caller to the proxy that asked.
+const (
+	authUserHeader   = "X-Auth-User"
+	authGroupsHeader = "X-Auth-Groups"
+)
+
+// respondAuthStatus reports a missing or expired login to the proxy, without
+// a body.
+func respondAuthStatus(c *gin.Context) {
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+// handleAuth answers the auth subrequests of a proxy such as ingress-nginx
+// using this app as an external authorizer. It responds 200 with the caller's
+// user and comma-separated groups in headers when the caller has access, 401
+// without a session or credentials and 403 when denied, always without a body
+// since the proxy only looks at the status and headers.
+func (s *Server) handleAuth(c *gin.Context) {
+	id, clientset, clientErr := s.requestClient(c)
+	if clientErr != nil {
+		c.AbortWithStatus(clientErr.Status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	result, authzErr := s.checkAccess(ctx, clientset, id)
+	if authzErr != nil {
+		c.AbortWithStatus(authzErr.Status)
+		return
+	}
+	if !result.Allowed {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	c.Header(authUserHeader, id.User)
+	c.Header(authGroupsHeader, strings.Join(id.Groups, ","))
+	c.Status(http.StatusOK)
+}
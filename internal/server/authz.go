@@ -0,0 +1,525 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// canAccess asks the API server whether id may perform the configured access
+// verb on the access resource. Unlike scanning bindings, this honors
+// aggregated roles, wildcards and every configured authorizer.
+func canAccess(ctx context.Context, clientset kubernetes.Interface, cfg Config, id identity) (bool, error) {
+	return reviewAccess(ctx, clientset, id, accessAttributes(cfg))
+}
+
+// reviewAccess asks the API server whether id may perform attributes. An
+// identity checked with its own credentials asks for itself with a
+// SelfSubjectAccessReview, since ordinary users may not create
+// SubjectAccessReviews; anyone else, such as an impersonated user or an OIDC
+// user checked with the app's credentials, is reviewed with a
+// SubjectAccessReview of its user and groups, so grants to its groups count.
+func reviewAccess(ctx context.Context, clientset kubernetes.Interface, id identity, attributes *authorizationv1.ResourceAttributes) (bool, error) {
+	if id.OwnCredentials {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attributes},
+		}
+		result, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return false, err
+		}
+		return result.Status.Allowed, nil
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               id.User,
+			Groups:             id.Groups,
+			ResourceAttributes: attributes,
+		},
+	}
+
+	result, err := clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	return result.Status.Allowed, nil
+}
+
+// accessAttributes returns the resource the access review of cfg asks about.
+func accessAttributes(cfg Config) *authorizationv1.ResourceAttributes {
+	return &authorizationv1.ResourceAttributes{
+		Group:     cfg.AccessAPIGroup,
+		Resource:  cfg.AccessResource,
+		Verb:      cfg.AccessVerb,
+		Namespace: cfg.AccessNamespace,
+		Name:      cfg.AccessName,
+	}
+}
+
+// describeAccess phrases the access review of cfg as what the user must be
+// able to do, such as "get deployments.apps in namespace prod".
+func describeAccess(cfg Config) string {
+	description := cfg.AccessVerb + " " + cfg.AccessResource
+	if cfg.AccessAPIGroup != "" {
+		description += "." + cfg.AccessAPIGroup
+	}
+	if cfg.AccessName != "" {
+		description += " " + cfg.AccessName
+	}
+	if cfg.AccessNamespace != "" {
+		description += " in namespace " + cfg.AccessNamespace
+	}
+	return description
+}
+
+// splitServiceAccountUsername splits a "system:serviceaccount:<ns>:<name>"
+// username into its namespace and name.
+func splitServiceAccountUsername(user string) (namespace, name string, ok bool) {
+	parts := strings.Split(user, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return "", "", false
+	}
+	return parts[2], parts[3], true
+}
+
+// serviceAccountGroups returns the groups a service account belongs to implicitly.
+func serviceAccountGroups(namespace string) []string {
+	return []string{"system:authenticated", "system:serviceaccounts", "system:serviceaccounts:" + namespace}
+}
+
+// subjectMatcher compares binding subjects with identities.
+type subjectMatcher struct {
+	// caseInsensitive matches names regardless of case, for OIDC providers
+	// that don't preserve the case of usernames and groups
+	caseInsensitive bool
+}
+
+// equal compares two subject names.
+func (m subjectMatcher) equal(a, b string) bool {
+	if m.caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// matches reports whether a binding subject refers to id, either directly or
+// through one of its groups. A service account subject matches any identity
+// whose username is that account's system:serviceaccount:<ns>:<name>, as the
+// API server authenticates it, whatever kind the identity was stored as.
+func (m subjectMatcher) matches(subject rbacv1.Subject, id identity) bool {
+	switch subject.Kind {
+	case rbacv1.UserKind:
+		return m.equal(subject.Name, id.User)
+	case rbacv1.GroupKind:
+		return slices.ContainsFunc(id.Groups, func(group string) bool { return m.equal(subject.Name, group) })
+	case rbacv1.ServiceAccountKind:
+		namespace, name, ok := splitServiceAccountUsername(id.User)
+		return ok && m.equal(subject.Namespace, namespace) && m.equal(subject.Name, name)
+	}
+	return false
+}
+
+// otherKind reports whether subject, though it doesn't refer to id, has the
+// name of id or of one of its groups, as when a user is bound as a Group. It
+// returns the kind the subject needs to refer to id.
+func (m subjectMatcher) otherKind(subject rbacv1.Subject, id identity) (string, bool) {
+	if m.matches(subject, id) {
+		return "", false
+	}
+	if m.equal(subject.Name, id.User) {
+		if _, _, ok := splitServiceAccountUsername(id.User); ok {
+			return rbacv1.ServiceAccountKind, true
+		}
+		return rbacv1.UserKind, true
+	}
+	if slices.ContainsFunc(id.Groups, func(group string) bool { return m.equal(subject.Name, group) }) {
+		return rbacv1.GroupKind, true
+	}
+	return "", false
+}
+
+// hasSubject reports whether id is one of subjects, either directly or
+// through one of its groups.
+func (m subjectMatcher) hasSubject(subjects []rbacv1.Subject, id identity) bool {
+	for _, subject := range subjects {
+		if m.matches(subject, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// listPageSize is the number of bindings requested per page when listing.
+const listPageSize = 500
+
+// eachClusterRoleBinding lists ClusterRoleBindings a page at a time, calling
+// fn for each one until fn returns false or the list is exhausted.
+func eachClusterRoleBinding(ctx context.Context, clientset kubernetes.Interface, fn func(rbacv1.ClusterRoleBinding) bool) error {
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		listStart := time.Now()
+		page, err := clientset.RbacV1().ClusterRoleBindings().List(ctx, opts)
+		kubeAPIRequestDuration.WithLabelValues("list_clusterrolebindings").Observe(time.Since(listStart).Seconds())
+		if err != nil {
+			return err
+		}
+
+		for _, crb := range page.Items {
+			if !fn(crb) {
+				return nil
+			}
+		}
+
+		if page.Continue == "" {
+			return nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// eachClusterRoleBinding calls fn for each ClusterRoleBinding of contextName
+// until fn returns false. Bindings are read from the context's informer, and
+// only listed from the API server with clientset while the informer is
+// unavailable.
+func (s *Server) eachClusterRoleBinding(ctx context.Context, clientset kubernetes.Interface, contextName string, fn func(rbacv1.ClusterRoleBinding) bool) error {
+	if crbs, ok := s.crbInformers.list(ctx, contextName); ok {
+		for _, crb := range crbs {
+			if !fn(*crb) {
+				return nil
+			}
+		}
+		return nil
+	}
+	return eachClusterRoleBinding(ctx, clientset, fn)
+}
+
+// eachRoleBinding lists the RoleBindings in namespace, or in all namespaces
+// when it is empty, a page at a time, calling fn for each one until fn returns
+// false or the list is exhausted.
+func eachRoleBinding(ctx context.Context, clientset kubernetes.Interface, namespace string, fn func(rbacv1.RoleBinding) bool) error {
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		listStart := time.Now()
+		page, err := clientset.RbacV1().RoleBindings(namespace).List(ctx, opts)
+		kubeAPIRequestDuration.WithLabelValues("list_rolebindings").Observe(time.Since(listStart).Seconds())
+		if err != nil {
+			return err
+		}
+
+		for _, rb := range page.Items {
+			if !fn(rb) {
+				return nil
+			}
+		}
+
+		if page.Continue == "" {
+			return nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// authzResult is the outcome of an authorization check.
+type authzResult struct {
+	Allowed bool
+	// Role is the required role whose binding granted access. It is empty
+	// when access was decided by a SubjectAccessReview.
+	Role string
+	// Binding is the binding that granted access, empty when access was
+	// decided by a SubjectAccessReview.
+	Binding string
+	// Namespace is the namespace whose RoleBinding granted access. It is
+	// empty when access was granted cluster-wide.
+	Namespace string
+	// Reason is why access was denied, and Explanation says so in words
+	// the user can take to an admin. Both are empty when access was granted.
+	Reason      denialReason
+	Explanation string
+}
+
+// denialReason is why an authorization check turned a user away.
+type denialReason string
+
+const (
+	// denialNotAllowlisted is a user missing from ALLOWED_USERS
+	denialNotAllowlisted denialReason = "NotAllowlisted"
+	// denialAccessReview is a SubjectAccessReview that didn't allow the user
+	denialAccessReview denialReason = "AccessReviewDenied"
+	// denialNoMatchingBinding is a user who is no binding's subject at all
+	denialNoMatchingBinding denialReason = "NoMatchingBinding"
+	// denialWrongSubjectKind is a required binding that names the user, or
+	// one of its groups, as the wrong kind of subject
+	denialWrongSubjectKind denialReason = "WrongSubjectKind"
+	// denialRoleNotHeld is a user whose bindings don't include a required
+	// role or binding
+	denialRoleNotHeld denialReason = "RoleNotHeld"
+)
+
+// bindingDenial gathers, while the bindings are scanned, why id is denied
+// if no binding grants it access.
+type bindingDenial struct {
+	// heldRoles are the roles of the bindings that have id as a subject
+	heldRoles []string
+	// wrongKind describes the first required binding naming id as the wrong
+	// kind of subject
+	wrongKind string
+}
+
+// noteDenial records in denial a binding that doesn't grant id access.
+func (s *Server) noteDenial(denial *bindingDenial, kind, namespace, name string, roleRef rbacv1.RoleRef, subjects []rbacv1.Subject, id identity) {
+	if s.subjects.hasSubject(subjects, id) {
+		if !slices.Contains(denial.heldRoles, roleRef.Name) {
+			denial.heldRoles = append(denial.heldRoles, roleRef.Name)
+		}
+		return
+	}
+	if denial.wrongKind != "" || !(s.requiredRoles.matches(roleRef.Name) || s.requiredBinding(namespace, name)) {
+		return
+	}
+	for _, subject := range subjects {
+		wantKind, ok := s.subjects.otherKind(subject, id)
+		if !ok {
+			continue
+		}
+		where := ""
+		if namespace != "" {
+			where = " in namespace " + namespace
+		}
+		denial.wrongKind = fmt.Sprintf("The %s %s%s names %s as a %s rather than a %s subject, so it doesn't apply to you. Ask an admin to fix the subject kind.", kind, name, where, subject.Name, subject.Kind, wantKind)
+		return
+	}
+}
+
+// merge adds what other noted to d, keeping the wrong subject kind d noted
+// first.
+func (d *bindingDenial) merge(other bindingDenial) {
+	for _, role := range other.heldRoles {
+		if !slices.Contains(d.heldRoles, role) {
+			d.heldRoles = append(d.heldRoles, role)
+		}
+	}
+	if d.wrongKind == "" {
+		d.wrongKind = other.wrongKind
+	}
+}
+
+// result returns the denial of id.
+func (d bindingDenial) result(id identity) authzResult {
+	switch {
+	case d.wrongKind != "":
+		return authzResult{Reason: denialWrongSubjectKind, Explanation: d.wrongKind}
+	case len(d.heldRoles) > 0:
+		return authzResult{Reason: denialRoleNotHeld, Explanation: fmt.Sprintf("You are bound to %s, but none of these is a required role or binding.", strings.Join(d.heldRoles, ", "))}
+	}
+	return authzResult{Reason: denialNoMatchingBinding, Explanation: fmt.Sprintf("No binding has %s or one of its groups as a subject.", id.User)}
+}
+
+// authorize decides whether id may access the home page, turning away users
+// missing from ALLOWED_USERS when it is set, then using a
+// SubjectAccessReview when an access resource is configured and otherwise
+// requiring a ClusterRoleBinding, or a RoleBinding in the target namespace or
+// any namespace, that binds id to one of the required roles or is one of the
+// required bindings. Both kinds of binding are scanned concurrently, and the
+// first match ends both scans. clientset can be
+// any kubernetes.Interface, such as the fake clientset from client-go.
+func (s *Server) authorize(ctx context.Context, clientset kubernetes.Interface, id identity) (authzResult, *httpError) {
+	logger := requestLog(ctx)
+	if !s.userAllowed(id.User) {
+		// Turned away before any call to the cluster
+		return authzResult{Reason: denialNotAllowlisted, Explanation: fmt.Sprintf("%s is not on the allowlist of users.", id.User)}, nil
+	}
+	if s.cfg.AccessResource != "" {
+		// Ask the API server directly when an access check is configured
+		allowed, err := canAccess(ctx, clientset, s.cfg, id)
+		if err != nil {
+			logger.Error("Failed to create SubjectAccessReview", "context", id.Context, "user", id.User, "error", err)
+			return authzResult{}, kubeAPIError(err, "Failed to review access")
+		}
+		if !allowed {
+			return authzResult{Reason: denialAccessReview, Explanation: fmt.Sprintf("The API server does not allow %s to %s.", id.User, describeAccess(s.cfg))}, nil
+		}
+		return authzResult{Allowed: true}, nil
+	}
+
+	// Scan the ClusterRoleBindings and the RoleBindings at the same time,
+	// calling off both scans at the first match. Each scan notes why its
+	// bindings don't grant access
+	scanCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	group, scanCtx := errgroup.WithContext(scanCtx)
+
+	var matched atomic.Bool
+	var crbResult, rbResult authzResult
+	var crbDenial, rbDenial bindingDenial
+	group.Go(func() error {
+		err := s.eachClusterRoleBinding(scanCtx, clientset, id.Context, func(crb rbacv1.ClusterRoleBinding) bool {
+			if scanCtx.Err() != nil {
+				return false
+			}
+			if s.grantsAccess("", crb.Name, crb.RoleRef, crb.Subjects, id) {
+				crbResult = authzResult{Allowed: true, Role: crb.RoleRef.Name, Binding: crb.Name}
+				matched.Store(true)
+				cancel()
+				return false
+			}
+			s.noteDenial(&crbDenial, "ClusterRoleBinding", "", crb.Name, crb.RoleRef, crb.Subjects, id)
+			return true
+		})
+		if err != nil && !matched.Load() {
+			logger.Error("Failed to list ClusterRoleBindings", "context", id.Context, "error", err)
+			return kubeAPIError(err, "Failed to list ClusterRoleBindings")
+		}
+		return nil
+	})
+	group.Go(func() error {
+		err := eachRoleBinding(scanCtx, clientset, s.cfg.TargetNamespace, func(rb rbacv1.RoleBinding) bool {
+			if scanCtx.Err() != nil {
+				return false
+			}
+			if s.grantsAccess(rb.Namespace, rb.Name, rb.RoleRef, rb.Subjects, id) {
+				rbResult = authzResult{Allowed: true, Role: rb.RoleRef.Name, Binding: rb.Name, Namespace: rb.Namespace}
+				matched.Store(true)
+				cancel()
+				return false
+			}
+			s.noteDenial(&rbDenial, "RoleBinding", rb.Namespace, rb.Name, rb.RoleRef, rb.Subjects, id)
+			return true
+		})
+		switch {
+		case err == nil || matched.Load():
+		case apierrors.IsForbidden(err):
+			// Without access to the RoleBindings only cluster-wide grants count
+			logger.Warn("Not allowed to list RoleBindings", "context", id.Context, "namespace", s.cfg.TargetNamespace, "error", err)
+		default:
+			logger.Error("Failed to list RoleBindings", "context", id.Context, "error", err)
+			return kubeAPIError(err, "Failed to list RoleBindings")
+		}
+		return nil
+	})
+
+	if err := group.Wait(); err != nil {
+		return authzResult{}, err.(*httpError)
+	}
+	// A cluster-wide grant wins when both scans matched before being called off
+	switch {
+	case crbResult.Allowed:
+		return crbResult, nil
+	case rbResult.Allowed:
+		return rbResult, nil
+	}
+	crbDenial.merge(rbDenial)
+	return crbDenial.result(id), nil
+}
+
+// userAllowed reports whether user is in ALLOWED_USERS, or whether every user
+// is allowed to go on to the RBAC checks because it is unset.
+func (s *Server) userAllowed(user string) bool {
+	if len(s.cfg.AllowedUsers) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.cfg.AllowedUsers, func(allowed string) bool { return s.subjects.equal(allowed, user) })
+}
+
+// cachedAuthorize returns the cached decision for id, authorizing id and
+// caching the decision when there is none.
+func (s *Server) cachedAuthorize(ctx context.Context, clientset kubernetes.Interface, id identity) (authzResult, *httpError) {
+	if s.authzCache == nil {
+		return s.authorize(ctx, clientset, id)
+	}
+
+	now := time.Now()
+	result, hit := s.authzCache.get(id, now)
+	recordAuthzCacheLookup(hit)
+	if hit {
+		return result, nil
+	}
+
+	result, err := s.authorize(ctx, clientset, id)
+	if err != nil {
+		return authzResult{}, err
+	}
+	s.authzCache.put(id, result, now)
+	return result, nil
+}
+
+// checkAccess authorizes id and records the decision in the metrics, the
+// audit log and the request log.
+func (s *Server) checkAccess(ctx context.Context, clientset kubernetes.Interface, id identity) (authzResult, *httpError) {
+	result, err := s.cachedAuthorize(ctx, clientset, id)
+	if err != nil {
+		return authzResult{}, err
+	}
+
+	recordAuthzDecision(result.Allowed)
+	s.auditDecision(id, result)
+	requestLog(ctx).Info("Authorization decision",
+		"context", id.Context,
+		"user", id.User,
+		"decision", authzDecision(result.Allowed),
+		"namespace", result.Namespace,
+		"reason", result.Reason,
+	)
+	return result, nil
+}
+
+// requiredBinding reports whether the named binding is one of
+// REQUIRED_BINDING: a ClusterRoleBinding by its name, when namespace is
+// empty, or a RoleBinding by its namespace/name.
+func (s *Server) requiredBinding(namespace, name string) bool {
+	if namespace == "" {
+		return s.requiredBindings[name]
+	}
+	return s.requiredBindings[namespace+"/"+name]
+}
+
+// grantsAccess reports whether the binding namespace/name of roleRef to
+// subjects grants id access: it must have id as a subject and either bind one
+// of the required roles or be one of the required bindings itself.
+func (s *Server) grantsAccess(namespace, name string, roleRef rbacv1.RoleRef, subjects []rbacv1.Subject, id identity) bool {
+	required := s.requiredRoles.matches(roleRef.Name) || s.requiredBinding(namespace, name)
+	return required && s.subjects.hasSubject(subjects, id)
+}
+
+// grantsRequiredRole reports whether a binding of roleRef to subjects binds
+// id to one of requiredRoles.
+func (s *Server) grantsRequiredRole(roleRef rbacv1.RoleRef, subjects []rbacv1.Subject, requiredRoles map[string]bool, id identity) bool {
+	return requiredRoles[roleRef.Name] && s.subjects.hasSubject(subjects, id)
+}
+
+// userClusterRoleBindings returns the ClusterRoleBindings that have id as a
+// subject, or all of them when all is set.
+func (s *Server) userClusterRoleBindings(ctx context.Context, clientset kubernetes.Interface, id identity, all bool) ([]rbacv1.ClusterRoleBinding, error) {
+	var matched []rbacv1.ClusterRoleBinding
+	err := s.eachClusterRoleBinding(ctx, clientset, id.Context, func(crb rbacv1.ClusterRoleBinding) bool {
+		if all || s.subjects.hasSubject(crb.Subjects, id) {
+			matched = append(matched, crb)
+		}
+		return true
+	})
+	return matched, err
+}
+
+// userRoleBindings returns the RoleBindings in namespace, or in all namespaces
+// when it is empty, that have id as a subject, or all of them when all is set.
+func (s *Server) userRoleBindings(ctx context.Context, clientset kubernetes.Interface, namespace string, id identity, all bool) ([]rbacv1.RoleBinding, error) {
+	var matched []rbacv1.RoleBinding
+	err := eachRoleBinding(ctx, clientset, namespace, func(rb rbacv1.RoleBinding) bool {
+		if all || s.subjects.hasSubject(rb.Subjects, id) {
+			matched = append(matched, rb)
+		}
+		return true
+	})
+	return matched, err
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// clusterRoleBinding returns a ClusterRoleBinding of the ClusterRole role to
+// subjects.
+func clusterRoleBinding(name, role string, subjects ...rbacv1.Subject) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: role},
+		Subjects:   subjects,
+	}
+}
+
+// roleBinding returns a RoleBinding in namespace of the ClusterRole role to
+// subjects.
+func roleBinding(namespace, name, role string, subjects ...rbacv1.Subject) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: role},
+		Subjects:   subjects,
+	}
+}
+
+func userSubject(name string) rbacv1.Subject {
+	return rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: name}
+}
+
+func groupSubject(name string) rbacv1.Subject {
+	return rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: name}
+}
+
+func serviceAccountSubject(namespace, name string) rbacv1.Subject {
+	return rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: namespace, Name: name}
+}
+
+// authorizeWith authorizes id against a fake cluster holding bindings, on a
+// server configured by cfg.
+func authorizeWith(t *testing.T, cfg Config, id identity, bindings ...runtime.Object) authzResult {
+	t.Helper()
+
+	clientset := fake.NewSimpleClientset(bindings...)
+	s := newTestServer(t, cfg, testClientsets(clientset))
+
+	id.Context = testContext
+	result, err := s.authorize(context.Background(), clientset, id)
+	if err != nil {
+		t.Fatalf("authorize failed: %v", err)
+	}
+	return result
+}
+
+func TestAuthorize(t *testing.T) {
+	alice := identity{User: "alice", Groups: []string{"system:authenticated", "developers"}, Kind: rbacv1.UserKind}
+	robot := identity{User: "system:serviceaccount:ci:deployer", Groups: serviceAccountGroups("ci"), Kind: rbacv1.ServiceAccountKind}
+
+	tests := []struct {
+		name          string
+		requiredRoles []string
+		id            identity
+		bindings      []runtime.Object
+		want          authzResult
+	}{
+		{
+			name:          "ClusterRoleBinding of the user",
+			requiredRoles: []string{"viewer"},
+			id:            alice,
+			bindings:      []runtime.Object{clusterRoleBinding("alice-viewer", "viewer", userSubject("alice"))},
+			want:          authzResult{Allowed: true, Role: "viewer", Binding: "alice-viewer"},
+		},
+		{
+			name:          "ClusterRoleBinding of a group of the user",
+			requiredRoles: []string{"viewer"},
+			id:            alice,
+			bindings:      []runtime.Object{clusterRoleBinding("developers-viewer", "viewer", groupSubject("developers"))},
+			want:          authzResult{Allowed: true, Role: "viewer", Binding: "developers-viewer"},
+		},
+		{
+			name:          "ClusterRoleBinding of a service account",
+			requiredRoles: []string{"viewer"},
+			id:            robot,
+			bindings:      []runtime.Object{clusterRoleBinding("deployer-viewer", "viewer", serviceAccountSubject("ci", "deployer"))},
+			want:          authzResult{Allowed: true, Role: "viewer", Binding: "deployer-viewer"},
+		},
+		{
+			name:          "RoleBinding grants access in its namespace",
+			requiredRoles: []string{"viewer"},
+			id:            alice,
+			bindings:      []runtime.Object{roleBinding("team-a", "alice-viewer", "viewer", userSubject("alice"))},
+			want:          authzResult{Allowed: true, Role: "viewer", Binding: "alice-viewer", Namespace: "team-a"},
+		},
+		{
+			name:          "any one of several required roles",
+			requiredRoles: []string{"viewer", "editor"},
+			id:            alice,
+			bindings: []runtime.Object{
+				clusterRoleBinding("alice-admin", "admin", userSubject("alice")),
+				clusterRoleBinding("developers-editor", "editor", groupSubject("developers")),
+			},
+			want: authzResult{Allowed: true, Role: "editor", Binding: "developers-editor"},
+		},
+		{
+			name:          "denied without a binding",
+			requiredRoles: []string{"viewer"},
+			id:            alice,
+			bindings:      []runtime.Object{clusterRoleBinding("bob-viewer", "viewer", userSubject("bob"))},
+			want:          authzResult{Reason: denialNoMatchingBinding},
+		},
+		{
+			name:          "denied when bound to another role",
+			requiredRoles: []string{"viewer"},
+			id:            alice,
+			bindings: []runtime.Object{
+				clusterRoleBinding("alice-admin", "admin", userSubject("alice")),
+				roleBinding("team-a", "developers-editor", "editor", groupSubject("developers")),
+			},
+			want: authzResult{Reason: denialRoleNotHeld},
+		},
+		{
+			name:          "denied when named as the wrong kind of subject",
+			requiredRoles: []string{"viewer"},
+			id:            alice,
+			bindings:      []runtime.Object{clusterRoleBinding("alice-viewer", "viewer", groupSubject("alice"))},
+			want:          authzResult{Reason: denialWrongSubjectKind},
+		},
+		{
+			name:          "service account of another namespace is denied",
+			requiredRoles: []string{"viewer"},
+			id:            robot,
+			bindings:      []runtime.Object{clusterRoleBinding("deployer-viewer", "viewer", serviceAccountSubject("prod", "deployer"))},
+			want:          authzResult{Reason: denialNoMatchingBinding},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := authorizeWith(t, testConfig(t, tt.requiredRoles...), tt.id, tt.bindings...)
+			// The explanation is for people, only the reason is compared
+			got.Explanation = ""
+			if got != tt.want {
+				t.Errorf("authorize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubjectMatcherMatches(t *testing.T) {
+	alice := identity{User: "Alice", Groups: []string{"system:authenticated", "Platform-Team"}, Kind: rbacv1.UserKind}
+	deployer := identity{User: "system:serviceaccount:ci:deployer", Groups: serviceAccountGroups("ci"), Kind: rbacv1.ServiceAccountKind}
+	// A kubeconfig user named like a service account, as a static token's
+	// user can be, is matched by that name all the same
+	lookalike := identity{User: "system:serviceaccount:ci:deployer", Kind: rbacv1.UserKind}
+
+	tests := []struct {
+		name            string
+		caseInsensitive bool
+		subject         rbacv1.Subject
+		id              identity
+		want            bool
+	}{
+		{name: "user of the same case", subject: userSubject("Alice"), id: alice, want: true},
+		{name: "user of another case", subject: userSubject("alice"), id: alice},
+		{name: "user of another case, case-insensitive", caseInsensitive: true, subject: userSubject("alice"), id: alice, want: true},
+		{name: "group of the same case", subject: groupSubject("Platform-Team"), id: alice, want: true},
+		{name: "group of another case", subject: groupSubject("platform-team"), id: alice},
+		{name: "group of another case, case-insensitive", caseInsensitive: true, subject: groupSubject("platform-team"), id: alice, want: true},
+		{name: "case-insensitive still needs the same name", caseInsensitive: true, subject: userSubject("alicia"), id: alice},
+		{name: "user is not a group", subject: groupSubject("Alice"), id: alice},
+		{name: "group is not a user", subject: userSubject("Platform-Team"), id: alice},
+		{name: "service account", subject: serviceAccountSubject("ci", "deployer"), id: deployer, want: true},
+		{name: "service account of another namespace", subject: serviceAccountSubject("prod", "deployer"), id: deployer},
+		{name: "another service account", subject: serviceAccountSubject("ci", "builder"), id: deployer},
+		{name: "service account by its username", subject: userSubject("system:serviceaccount:ci:deployer"), id: deployer, want: true},
+		{name: "service account by its namespace group", subject: groupSubject("system:serviceaccounts:ci"), id: deployer, want: true},
+		{name: "service account by another namespace group", subject: groupSubject("system:serviceaccounts:prod"), id: deployer},
+		{name: "look-alike user is the service account", subject: serviceAccountSubject("ci", "deployer"), id: lookalike, want: true},
+		{name: "look-alike user of another namespace", subject: serviceAccountSubject("prod", "deployer"), id: lookalike},
+		{name: "look-alike user named after another namespace", subject: userSubject("system:serviceaccount:prod:deployer"), id: lookalike},
+		{name: "plain user is no service account", subject: serviceAccountSubject("ci", "deployer"), id: identity{User: "deployer", Kind: rbacv1.UserKind}},
+		{name: "unknown subject kind", subject: rbacv1.Subject{Kind: "Robot", Name: "Alice"}, id: alice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := subjectMatcher{caseInsensitive: tt.caseInsensitive}
+			if got := m.matches(tt.subject, tt.id); got != tt.want {
+				t.Errorf("matches(%s %s/%s, %s) = %t, want %t", tt.subject.Kind, tt.subject.Namespace, tt.subject.Name, tt.id.User, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubjectMatcherOtherKind(t *testing.T) {
+	alice := identity{User: "alice", Groups: []string{"developers"}, Kind: rbacv1.UserKind}
+	deployer := identity{User: "system:serviceaccount:ci:deployer", Kind: rbacv1.ServiceAccountKind}
+
+	tests := []struct {
+		name     string
+		subject  rbacv1.Subject
+		id       identity
+		wantKind string
+		want     bool
+	}{
+		{name: "user bound as a group", subject: groupSubject("alice"), id: alice, wantKind: rbacv1.UserKind, want: true},
+		{name: "group bound as a user", subject: userSubject("developers"), id: alice, wantKind: rbacv1.GroupKind, want: true},
+		{name: "service account bound as a group", subject: groupSubject("system:serviceaccount:ci:deployer"), id: deployer, wantKind: rbacv1.ServiceAccountKind, want: true},
+		{name: "matching subject", subject: userSubject("alice"), id: alice},
+		{name: "unrelated subject", subject: groupSubject("ops"), id: alice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, ok := subjectMatcher{}.otherKind(tt.subject, tt.id)
+			if kind != tt.wantKind || ok != tt.want {
+				t.Errorf("otherKind() = %q, %t, want %q, %t", kind, ok, tt.wantKind, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeCaseInsensitive(t *testing.T) {
+	alice := identity{User: "Alice@Example.com", Groups: []string{"Developers"}, Kind: rbacv1.UserKind}
+	binding := clusterRoleBinding("alice-viewer", "viewer", userSubject("alice@example.com"))
+
+	for _, caseInsensitive := range []bool{false, true} {
+		cfg := testConfig(t, "viewer")
+		cfg.AuthzCaseInsensitive = caseInsensitive
+		if got := authorizeWith(t, cfg, alice, binding); got.Allowed != caseInsensitive {
+			t.Errorf("with AUTHZ_CASE_INSENSITIVE=%t, authorize() allowed = %t, want %t", caseInsensitive, got.Allowed, caseInsensitive)
+		}
+	}
+}
+
+func TestAuthorizeRequiredBinding(t *testing.T) {
+	alice := identity{User: "alice", Groups: []string{"system:authenticated", "developers"}, Kind: rbacv1.UserKind}
+
+	tests := []struct {
+		name     string
+		required []string
+		bindings []runtime.Object
+		want     authzResult
+	}{
+		{
+			name:     "ClusterRoleBinding by name",
+			required: []string{"platform-access"},
+			bindings: []runtime.Object{clusterRoleBinding("platform-access", "view", groupSubject("developers"))},
+			want:     authzResult{Allowed: true, Role: "view", Binding: "platform-access"},
+		},
+		{
+			name:     "RoleBinding by namespace/name",
+			required: []string{"team-a/app-access"},
+			bindings: []runtime.Object{roleBinding("team-a", "app-access", "edit", userSubject("alice"))},
+			want:     authzResult{Allowed: true, Role: "edit", Binding: "app-access", Namespace: "team-a"},
+		},
+		{
+			name:     "RoleBinding of the same name in another namespace",
+			required: []string{"team-a/app-access"},
+			bindings: []runtime.Object{roleBinding("team-b", "app-access", "edit", userSubject("alice"))},
+			want:     authzResult{Reason: denialRoleNotHeld},
+		},
+		{
+			name:     "RoleBinding named without its namespace",
+			required: []string{"app-access"},
+			bindings: []runtime.Object{roleBinding("team-a", "app-access", "edit", userSubject("alice"))},
+			want:     authzResult{Reason: denialRoleNotHeld},
+		},
+		{
+			name:     "required binding of someone else",
+			required: []string{"platform-access"},
+			bindings: []runtime.Object{clusterRoleBinding("platform-access", "view", userSubject("bob"))},
+			want:     authzResult{Reason: denialNoMatchingBinding},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.RequiredBindings = tt.required
+			got := authorizeWith(t, cfg, alice, tt.bindings...)
+			got.Explanation = ""
+			if got != tt.want {
+				t.Errorf("authorize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
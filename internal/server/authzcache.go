@@ -0,0 +1,96 @@
+package server
+
+import (
+	"crypto/sha256"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authzCacheKey identifies a cached decision. Decisions depend on the
+// cluster and on everything bindings can match, so the context, the kind of
+// subject, the user, its groups and whose credentials check it are all part
+// of the key. Identities without a context, such as OIDC users, differ by
+// their groups.
+type authzCacheKey struct {
+	context        string
+	kind           string
+	user           string
+	groups         [sha256.Size]byte
+	ownCredentials bool
+}
+
+// newAuthzCacheKey returns the key of id's decision. The groups are hashed in
+// sorted order, so the same groups in a different order share a decision.
+func newAuthzCacheKey(id identity) authzCacheKey {
+	groups := slices.Clone(id.Groups)
+	slices.Sort(groups)
+	return authzCacheKey{
+		context:        id.Context,
+		kind:           id.Kind,
+		user:           id.User,
+		groups:         sha256.Sum256([]byte(strings.Join(groups, "\x00"))),
+		ownCredentials: id.OwnCredentials,
+	}
+}
+
+// authzCacheEntry is a cached decision and when it stops being valid.
+type authzCacheEntry struct {
+	result  authzResult
+	expires time.Time
+}
+
+// authzCache remembers authorization decisions for a short time, so a user
+// clicking around doesn't re-list every binding on each request.
+type authzCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[authzCacheKey]authzCacheEntry
+}
+
+// newAuthzCache returns a cache keeping decisions for ttl.
+func newAuthzCache(ttl time.Duration) *authzCache {
+	return &authzCache{
+		ttl:     ttl,
+		entries: make(map[authzCacheKey]authzCacheEntry),
+	}
+}
+
+// get returns the cached decision for id, if there is a current one.
+func (c *authzCache) get(id identity, now time.Time) (authzResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := newAuthzCacheKey(id)
+	entry, ok := c.entries[key]
+	if !ok {
+		return authzResult{}, false
+	}
+	if now.After(entry.expires) {
+		delete(c.entries, key)
+		return authzResult{}, false
+	}
+	return entry.result, true
+}
+
+// put caches the decision for id, dropping expired entries along the way.
+func (c *authzCache) put(id identity, result authzResult, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[newAuthzCacheKey(id)] = authzCacheEntry{result, now.Add(c.ttl)}
+}
+
+// invalidate drops the cached decision for id.
+func (c *authzCache) invalidate(id identity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, newAuthzCacheKey(id))
+}
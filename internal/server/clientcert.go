@@ -0,0 +1,163 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Client certificate auth modes selectable with CLIENT_CERT_AUTH.
+const (
+	// clientCertAuthTLS reads the client certificate verified by our own TLS
+	// listener against CLIENT_CA_FILE.
+	clientCertAuthTLS = "tls"
+
+	// clientCertAuthHeader trusts the subject forwarded by a TLS terminating
+	// proxy in TRUSTED_PROXIES, which must strip the header from clients.
+	clientCertAuthHeader = "header"
+)
+
+// clientCertDNHeader carries the verified client certificate's subject in
+// RFC 2253 form, as set by nginx's $ssl_client_s_dn.
+const clientCertDNHeader = "X-SSL-Client-S-DN"
+
+// clientCertAuth authenticates requests by the client certificate they were
+// made with, mapping its common name to the user and its organizations to
+// the groups, as the API server does for x509 client certs. The certificate
+// holder has no kubeconfig context, so the authorization checks are made with
+// the application's own credentials. Requests without a certificate are
+// passed through to the session checks. A forwarded subject is only trusted
+// from TRUSTED_PROXIES, as any client reaching the app directly could set it.
+func (s *Server) clientCertAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.cfg.ClientCertAuth == clientCertAuthHeader && c.GetHeader(clientCertDNHeader) != "" && !s.trustedProxy(c.RemoteIP()) {
+			requestLog(c.Request.Context()).Warn("Client certificate header from an untrusted peer", "peer", c.RemoteIP())
+			respondError(c, http.StatusUnauthorized, codeUnauthenticated, "Client certificate header is only accepted from trusted proxies")
+			return
+		}
+
+		user, groups, ok := s.clientCertSubject(c.Request)
+		if !ok {
+			c.Next()
+			return
+		}
+		if user == "" {
+			respondError(c, http.StatusUnauthorized, codeUnauthenticated, "Client certificate has no common name")
+			return
+		}
+
+		clientset, err := s.clientsets.Clientset("")
+		if err != nil {
+			requestLog(c.Request.Context()).Error("Failed to create Kubernetes clientset", "error", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to create Kubernetes clientset")
+			return
+		}
+
+		c.Set(requestAuthKey, &requestAuth{
+			id: identity{
+				User:   user,
+				Groups: append([]string{"system:authenticated"}, groups...),
+				Kind:   rbacv1.UserKind,
+			},
+			clientset: clientset,
+		})
+		c.Next()
+	}
+}
+
+// clientCertSubject returns the common name and organizations of the
+// request's client certificate, and whether it has one.
+func (s *Server) clientCertSubject(r *http.Request) (string, []string, bool) {
+	switch s.cfg.ClientCertAuth {
+	case clientCertAuthTLS:
+		// Only chains verified against the client CA, never bare peer certs
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return "", nil, false
+		}
+		subject := r.TLS.VerifiedChains[0][0].Subject
+		return subject.CommonName, subject.Organization, true
+	case clientCertAuthHeader:
+		dn := r.Header.Get(clientCertDNHeader)
+		if dn == "" {
+			return "", nil, false
+		}
+		user, groups := parseDN(dn)
+		return user, groups, true
+	default:
+		return "", nil, false
+	}
+}
+
+// trustedProxy reports whether the peer address ip is one of TRUSTED_PROXIES.
+func (s *Server) trustedProxy(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range s.cfg.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if net.ParseIP(proxy).Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDN returns the CN and O attributes of an RFC 2253 distinguished name
+// such as "CN=jane,O=dev,O=ops". Escaped commas are kept in values.
+func parseDN(dn string) (string, []string) {
+	var cn string
+	var orgs []string
+	for _, rdn := range splitDN(dn) {
+		key, value, ok := strings.Cut(rdn, "=")
+		if !ok {
+			continue
+		}
+		value = unescapeDNValue(strings.TrimSpace(value))
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "CN":
+			cn = value
+		case "O":
+			orgs = append(orgs, value)
+		}
+	}
+	return cn, orgs
+}
+
+// splitDN splits a distinguished name on its unescaped commas and plus signs.
+func splitDN(dn string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++
+		case ',', '+':
+			parts = append(parts, dn[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, dn[start:])
+}
+
+// unescapeDNValue removes the backslash escapes of a distinguished name value.
+func unescapeDNValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClientCertHeaderTrustedProxies(t *testing.T) {
+	// Test requests come from 127.0.0.1
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		wantCode       int
+	}{
+		{name: "trusted address", trustedProxies: []string{"127.0.0.1"}, wantCode: http.StatusOK},
+		{name: "trusted range", trustedProxies: []string{"10.0.0.0/8", "127.0.0.0/8"}, wantCode: http.StatusOK},
+		{name: "untrusted peer", trustedProxies: []string{"10.0.0.0/8"}, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, "viewer")
+			cfg.ClientCertAuth = clientCertAuthHeader
+			cfg.TrustedProxies = tt.trustedProxies
+			clientset := fake.NewSimpleClientset(clusterRoleBinding("ops-viewer", "viewer", groupSubject("ops")))
+			client := newTestClient(t, newTestServer(t, cfg, testClientsets(clientset)))
+
+			resp, body := client.get("/api/v1/home", http.Header{clientCertDNHeader: {"CN=jane,O=ops"}})
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("GET /api/v1/home with a client certificate header returned %d, want %d:\n%s", resp.StatusCode, tt.wantCode, body)
+			}
+		})
+	}
+}
+
+func TestClientCertHeaderRequiresTrustedProxies(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ClientCertAuth = clientCertAuthHeader
+	if err := cfg.validate(); err == nil {
+		t.Error("header client certificate auth was accepted without trusted proxies")
+	}
+
+	cfg.TrustedProxies = []string{"10.0.0.1"}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("header client certificate auth with trusted proxies was rejected: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// ClientsetFactory returns the Kubernetes client used for requests made
+// against a kubeconfig context. Tests can provide a fake clientset through it.
+type ClientsetFactory interface {
+	Clientset(contextName string) (kubernetes.Interface, error)
+}
+
+// clientsetCache holds one Kubernetes clientset per kubeconfig context so
+// handlers don't rebuild the client config and TLS transport on every request.
+// Concurrent first uses of a context share a single build, and builds of
+// different contexts don't wait for each other.
+type clientsetCache struct {
+	newConfig func(contextName string) (*rest.Config, error)
+	builds    singleflight.Group
+
+	mu         sync.RWMutex
+	clientsets map[string]kubernetes.Interface
+	// generation counts resets, so a build started before a reset doesn't
+	// cache a clientset for the replaced config
+	generation uint64
+}
+
+// newClientsetCache returns a ClientsetFactory that builds clientsets from the
+// REST config returned by newConfig the first time each context is used.
+func newClientsetCache(newConfig func(contextName string) (*rest.Config, error)) *clientsetCache {
+	return &clientsetCache{
+		newConfig:  newConfig,
+		clientsets: make(map[string]kubernetes.Interface),
+	}
+}
+
+// Clientset returns the cached clientset for contextName, creating it if needed.
+func (c *clientsetCache) Clientset(contextName string) (kubernetes.Interface, error) {
+	c.mu.RLock()
+	clientset, ok := c.clientsets[contextName]
+	generation := c.generation
+	c.mu.RUnlock()
+	if ok {
+		return clientset, nil
+	}
+
+	key := fmt.Sprintf("%d/%s", generation, contextName)
+	built, err, _ := c.builds.Do(key, func() (any, error) {
+		restConfig, err := c.newConfig(contextName)
+		if err != nil {
+			return nil, err
+		}
+		clientset, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.generation == generation {
+			c.clientsets[contextName] = clientset
+		}
+		return clientset, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return built.(kubernetes.Interface), nil
+}
+
+// reset drops the cached clientsets so they are rebuilt from the current
+// config on next use.
+func (c *clientsetCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clientsets = make(map[string]kubernetes.Interface)
+	c.generation++
+}
@@ -0,0 +1,638 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// Defaults used when neither the config file nor the environment sets a value.
+const (
+	defaultListenAddr        = ":8080"
+	defaultSessionMaxAge     = 8 * time.Hour
+	defaultAPITimeout        = 10 * time.Second
+	defaultRequestTimeout    = 30 * time.Second
+	defaultReadinessTimeout  = 2 * time.Second
+	defaultShutdownTimeout   = 15 * time.Second
+	defaultRateLimitRPS      = 10
+	defaultAuthzCacheTTL     = time.Minute
+	defaultDiscoveryAttempts = 3
+	defaultClusterTimeout    = 10 * time.Second
+	defaultClusterWorkers    = 4
+
+	// client-go's own 5 QPS and burst of 10 are shared by every user of a
+	// context, which throttles a gateway serving many at once
+	defaultKubeQPS   = 50
+	defaultKubeBurst = 100
+)
+
+// defaultSessionCookieName is the name of the session cookie unless
+// SESSION_COOKIE_NAME sets another.
+const defaultSessionCookieName = "kubeauth_session"
+
+// Deployment environments of APP_ENV, which picks gin's mode unless GIN_MODE
+// sets it.
+const (
+	appEnvProduction  = "production"
+	appEnvDevelopment = "development"
+)
+
+// minSessionSecretLength is the minimum accepted length of the session secret.
+const minSessionSecretLength = 32
+
+// Config holds every application setting. Values come from the optional YAML
+// file named by CONFIG_FILE, and environment variables override the file.
+type Config struct {
+	ListenAddr            string        `yaml:"listenAddr"`
+	BasePath              string        `yaml:"basePath"`
+	TLSCertFile           string        `yaml:"tlsCertFile"`
+	TLSKeyFile            string        `yaml:"tlsKeyFile"`
+	ClientCertAuth        string        `yaml:"clientCertAuth"`
+	ClientCAFile          string        `yaml:"clientCAFile"`
+	PprofAddr             string        `yaml:"pprofAddr"`
+	KubeConfigPath        string        `yaml:"kubeconfig"`
+	KubeConfigDir         string        `yaml:"kubeconfigDir"`
+	APIServerOverride     string        `yaml:"apiServerOverride"`
+	CAFile                string        `yaml:"caFile"`
+	InsecureSkipTLSVerify bool          `yaml:"insecureSkipTLSVerify"`
+	SessionSecret         string        `yaml:"sessionSecret"`
+	SessionSecretPrevious string        `yaml:"sessionSecretPrevious"`
+	SessionMaxAge         time.Duration `yaml:"sessionMaxAge"`
+	SessionIdleTimeout    time.Duration `yaml:"sessionIdleTimeout"`
+	SessionBackend        string        `yaml:"sessionBackend"`
+	SessionCookieName     string        `yaml:"sessionCookieName"`
+	RedisAddr             string        `yaml:"redisAddr"`
+	RedisPassword         string        `yaml:"redisPassword"`
+	CookieSecure          bool          `yaml:"cookieSecure"`
+	RequiredRoles         []string      `yaml:"requiredRoles"`
+	RequiredBindings      []string      `yaml:"requiredBindings"`
+	AuthzMatchMode        string        `yaml:"authzMatchMode"`
+	AdminRoles            []string      `yaml:"adminRoles"`
+	AllowedUsers          []string      `yaml:"allowedUsers"`
+	UserMappingFile       string        `yaml:"userMappingFile"`
+	AccessResource        string        `yaml:"accessResource"`
+	AccessVerb            string        `yaml:"accessVerb"`
+	AccessAPIGroup        string        `yaml:"accessAPIGroup"`
+	AccessNamespace       string        `yaml:"accessNamespace"`
+	AccessName            string        `yaml:"accessName"`
+	AuthzCacheTTL         time.Duration `yaml:"authzCacheTTL"`
+	ShowAllBindings       bool          `yaml:"showAllBindings"`
+	MultiCluster          bool          `yaml:"multiCluster"`
+	ClusterTimeout        time.Duration `yaml:"clusterTimeout"`
+	ClusterConcurrency    int           `yaml:"clusterConcurrency"`
+	AuthzCaseInsensitive  bool          `yaml:"authzCaseInsensitive"`
+	TargetNamespace       string        `yaml:"targetNamespace"`
+	APITimeout            time.Duration `yaml:"apiTimeout"`
+	RequestTimeout        time.Duration `yaml:"requestTimeout"`
+	DiscoveryAttempts     int           `yaml:"discoveryAttempts"`
+	KubeQPS               float64       `yaml:"kubeQPS"`
+	KubeBurst             int           `yaml:"kubeBurst"`
+	ReadinessTimeout      time.Duration `yaml:"readinessTimeout"`
+	ReadinessRoleCheck    bool          `yaml:"readinessRoleCheck"`
+	ShutdownTimeout       time.Duration `yaml:"shutdownTimeout"`
+	LogLevel              string        `yaml:"logLevel"`
+	AppEnv                string        `yaml:"appEnv"`
+	GinMode               string        `yaml:"ginMode"`
+	TemplatesDir          string        `yaml:"templatesDir"`
+	AuditLogPath          string        `yaml:"auditLogPath"`
+	DenyWebhookURL        string        `yaml:"denyWebhookURL"`
+	RateLimitRPS          float64       `yaml:"rateLimitRPS"`
+	TrustedProxies        []string      `yaml:"trustedProxies"`
+	CORSAllowedOrigins    []string      `yaml:"corsAllowedOrigins"`
+	OIDC                  OIDCConfig    `yaml:"oidc"`
+	GitHub                GitHubConfig  `yaml:"github"`
+}
+
+// OIDCConfig configures the optional OIDC login. OIDC is disabled when
+// IssuerURL is empty.
+type OIDCConfig struct {
+	IssuerURL     string `yaml:"issuerURL"`
+	ClientID      string `yaml:"clientID"`
+	ClientSecret  string `yaml:"clientSecret"`
+	RedirectURL   string `yaml:"redirectURL"`
+	UsernameClaim string `yaml:"usernameClaim"`
+	GroupsClaim   string `yaml:"groupsClaim"`
+	// UsernamePrefix and GroupsPrefix are prepended to the username and
+	// groups of the ID token, like the API server's --oidc-username-prefix
+	// and --oidc-groups-prefix.
+	UsernamePrefix string `yaml:"usernamePrefix"`
+	GroupsPrefix   string `yaml:"groupsPrefix"`
+}
+
+// GitHubConfig configures the optional GitHub OAuth2 login. GitHub login is
+// disabled when ClientID is empty. Teams are named "org:team-slug".
+type GitHubConfig struct {
+	ClientID     string   `yaml:"clientID"`
+	ClientSecret string   `yaml:"clientSecret"`
+	RedirectURL  string   `yaml:"redirectURL"`
+	Org          string   `yaml:"org"`
+	Teams        []string `yaml:"teams"`
+}
+
+// defaultConfig returns the settings used when neither the config file nor
+// the environment sets a value.
+func defaultConfig() Config {
+	return Config{
+		ListenAddr:         defaultListenAddr,
+		SessionMaxAge:      defaultSessionMaxAge,
+		SessionBackend:     sessionBackendCookie,
+		SessionCookieName:  defaultSessionCookieName,
+		CookieSecure:       true,
+		AccessVerb:         "get",
+		AuthzMatchMode:     roleMatchExact,
+		AuthzCacheTTL:      defaultAuthzCacheTTL,
+		APITimeout:         defaultAPITimeout,
+		RequestTimeout:     defaultRequestTimeout,
+		DiscoveryAttempts:  defaultDiscoveryAttempts,
+		ClusterTimeout:     defaultClusterTimeout,
+		ClusterConcurrency: defaultClusterWorkers,
+		KubeQPS:            defaultKubeQPS,
+		KubeBurst:          defaultKubeBurst,
+		ReadinessTimeout:   defaultReadinessTimeout,
+		ShutdownTimeout:    defaultShutdownTimeout,
+		LogLevel:           "info",
+		AppEnv:             appEnvProduction,
+		RateLimitRPS:       defaultRateLimitRPS,
+		OIDC: OIDCConfig{
+			UsernameClaim: "email",
+			GroupsClaim:   "groups",
+		},
+	}
+}
+
+// LoadConfig reads the YAML config file at path, if any, and applies
+// environment variable overrides on top of it.
+func LoadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+
+	// "/" and "/kubeauth/" mean the same as "" and "/kubeauth"
+	cfg.BasePath = strings.TrimRight(cfg.BasePath, "/")
+	return cfg, cfg.validate()
+}
+
+// applyEnv overrides settings with the environment variables that are set.
+func (cfg *Config) applyEnv() error {
+	var env envReader
+	cfg.ListenAddr = envString("LISTEN_ADDR", cfg.ListenAddr)
+	cfg.BasePath = envString("BASE_PATH", cfg.BasePath)
+	cfg.TLSCertFile = envString("TLS_CERT_FILE", cfg.TLSCertFile)
+	cfg.TLSKeyFile = envString("TLS_KEY_FILE", cfg.TLSKeyFile)
+	cfg.ClientCertAuth = envString("CLIENT_CERT_AUTH", cfg.ClientCertAuth)
+	cfg.ClientCAFile = envString("CLIENT_CA_FILE", cfg.ClientCAFile)
+	cfg.PprofAddr = envString("PPROF_ADDR", cfg.PprofAddr)
+	cfg.KubeConfigPath = envString("KUBECONFIG", cfg.KubeConfigPath)
+	cfg.KubeConfigDir = envString("KUBECONFIG_DIR", cfg.KubeConfigDir)
+	cfg.APIServerOverride = envString("API_SERVER_OVERRIDE", cfg.APIServerOverride)
+	cfg.CAFile = envString("CA_FILE", cfg.CAFile)
+	cfg.InsecureSkipTLSVerify = env.bool("INSECURE_SKIP_TLS_VERIFY", cfg.InsecureSkipTLSVerify)
+	cfg.SessionSecret = env.secret("SESSION_SECRET", cfg.SessionSecret)
+	cfg.SessionSecretPrevious = env.secret("SESSION_SECRET_PREVIOUS", cfg.SessionSecretPrevious)
+	cfg.SessionMaxAge = env.duration("SESSION_MAX_AGE", cfg.SessionMaxAge)
+	cfg.SessionIdleTimeout = env.duration("SESSION_IDLE_TIMEOUT", cfg.SessionIdleTimeout)
+	cfg.SessionBackend = envString("SESSION_BACKEND", cfg.SessionBackend)
+	cfg.SessionCookieName = envString("SESSION_COOKIE_NAME", cfg.SessionCookieName)
+	cfg.RedisAddr = envString("REDIS_ADDR", cfg.RedisAddr)
+	cfg.RedisPassword = env.secret("REDIS_PASSWORD", cfg.RedisPassword)
+	cfg.CookieSecure = env.bool("COOKIE_SECURE", cfg.CookieSecure)
+	cfg.RequiredRoles = envList("ACCESS_ROLE", envList("REQUIRED_ROLE", cfg.RequiredRoles))
+	cfg.RequiredBindings = envList("REQUIRED_BINDING", cfg.RequiredBindings)
+	cfg.AuthzMatchMode = envString("AUTHZ_MATCH_MODE", cfg.AuthzMatchMode)
+	cfg.AdminRoles = envList("ADMIN_ROLE", cfg.AdminRoles)
+	cfg.AllowedUsers = envList("ALLOWED_USERS", cfg.AllowedUsers)
+	cfg.UserMappingFile = envString("USER_MAPPING_FILE", cfg.UserMappingFile)
+	cfg.AccessResource = envString("ACCESS_RESOURCE", cfg.AccessResource)
+	cfg.AccessVerb = envString("ACCESS_VERB", cfg.AccessVerb)
+	cfg.AccessAPIGroup = envString("ACCESS_API_GROUP", cfg.AccessAPIGroup)
+	cfg.AccessNamespace = envString("ACCESS_NAMESPACE", cfg.AccessNamespace)
+	cfg.AccessName = envString("ACCESS_NAME", cfg.AccessName)
+	cfg.AuthzCacheTTL = env.duration("AUTHZ_CACHE_TTL", cfg.AuthzCacheTTL)
+	cfg.ShowAllBindings = env.bool("SHOW_ALL_BINDINGS", cfg.ShowAllBindings)
+	cfg.AuthzCaseInsensitive = env.bool("AUTHZ_CASE_INSENSITIVE", cfg.AuthzCaseInsensitive)
+	cfg.TargetNamespace = envString("TARGET_NAMESPACE", cfg.TargetNamespace)
+	cfg.APITimeout = env.duration("API_TIMEOUT", cfg.APITimeout)
+	cfg.RequestTimeout = env.duration("REQUEST_TIMEOUT", cfg.RequestTimeout)
+	cfg.DiscoveryAttempts = env.int("DISCOVERY_MAX_ATTEMPTS", cfg.DiscoveryAttempts)
+	cfg.MultiCluster = env.bool("MULTI_CLUSTER", cfg.MultiCluster)
+	cfg.ClusterTimeout = env.duration("CLUSTER_TIMEOUT", cfg.ClusterTimeout)
+	cfg.ClusterConcurrency = env.int("CLUSTER_CONCURRENCY", cfg.ClusterConcurrency)
+	cfg.KubeQPS = env.float("K8S_QPS", cfg.KubeQPS)
+	cfg.KubeBurst = env.int("K8S_BURST", cfg.KubeBurst)
+	cfg.ReadinessTimeout = env.duration("READINESS_TIMEOUT", cfg.ReadinessTimeout)
+	cfg.ReadinessRoleCheck = env.bool("READINESS_ROLE_CHECK", cfg.ReadinessRoleCheck)
+	cfg.ShutdownTimeout = env.duration("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout)
+	cfg.LogLevel = envString("LOG_LEVEL", cfg.LogLevel)
+	cfg.AppEnv = envString("APP_ENV", cfg.AppEnv)
+	cfg.GinMode = envString("GIN_MODE", cfg.GinMode)
+	cfg.TemplatesDir = envString("TEMPLATES_DIR", cfg.TemplatesDir)
+	cfg.AuditLogPath = envString("AUDIT_LOG_PATH", cfg.AuditLogPath)
+	cfg.DenyWebhookURL = envString("DENY_WEBHOOK_URL", cfg.DenyWebhookURL)
+	cfg.RateLimitRPS = env.float("RATE_LIMIT_RPS", cfg.RateLimitRPS)
+	cfg.TrustedProxies = envList("TRUSTED_PROXIES", cfg.TrustedProxies)
+	cfg.CORSAllowedOrigins = envList("CORS_ALLOWED_ORIGINS", cfg.CORSAllowedOrigins)
+
+	cfg.OIDC.IssuerURL = envString("OIDC_ISSUER_URL", cfg.OIDC.IssuerURL)
+	cfg.OIDC.ClientID = envString("OIDC_CLIENT_ID", cfg.OIDC.ClientID)
+	cfg.OIDC.ClientSecret = env.secret("OIDC_CLIENT_SECRET", cfg.OIDC.ClientSecret)
+	cfg.OIDC.RedirectURL = envString("OIDC_REDIRECT_URL", cfg.OIDC.RedirectURL)
+	cfg.OIDC.UsernameClaim = envString("OIDC_USERNAME_CLAIM", cfg.OIDC.UsernameClaim)
+	cfg.OIDC.GroupsClaim = envString("OIDC_GROUPS_CLAIM", cfg.OIDC.GroupsClaim)
+	cfg.OIDC.UsernamePrefix = envString("OIDC_USERNAME_PREFIX", cfg.OIDC.UsernamePrefix)
+	cfg.OIDC.GroupsPrefix = envString("OIDC_GROUPS_PREFIX", cfg.OIDC.GroupsPrefix)
+	cfg.GitHub.ClientID = envString("GITHUB_CLIENT_ID", cfg.GitHub.ClientID)
+	cfg.GitHub.ClientSecret = env.secret("GITHUB_CLIENT_SECRET", cfg.GitHub.ClientSecret)
+	cfg.GitHub.RedirectURL = envString("GITHUB_REDIRECT_URL", cfg.GitHub.RedirectURL)
+	cfg.GitHub.Org = envString("GITHUB_ORG", cfg.GitHub.Org)
+	cfg.GitHub.Teams = envList("GITHUB_TEAMS", cfg.GitHub.Teams)
+
+	return env.err
+}
+
+// TLSEnabled reports whether the server should serve HTTPS.
+func (cfg *Config) TLSEnabled() bool {
+	return cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+}
+
+// EffectiveGinMode returns gin's mode: GIN_MODE when set, otherwise debug
+// mode in development and release mode in production.
+func (cfg *Config) EffectiveGinMode() string {
+	switch {
+	case cfg.GinMode != "":
+		return cfg.GinMode
+	case cfg.AppEnv == appEnvDevelopment:
+		return gin.DebugMode
+	}
+	return gin.ReleaseMode
+}
+
+// redactedValue replaces secrets in the effective configuration shown by
+// /config.
+const redactedValue = "***"
+
+// redacted returns a copy of cfg with the secrets that are set replaced by
+// redactedValue, leaving unset ones empty so they can still be told apart.
+// The deny webhook URL counts as a secret since such URLs usually embed a
+// token.
+func (cfg *Config) redacted() Config {
+	redact := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return redactedValue
+	}
+
+	redacted := *cfg
+	redacted.SessionSecret = redact(cfg.SessionSecret)
+	redacted.SessionSecretPrevious = redact(cfg.SessionSecretPrevious)
+	redacted.RedisPassword = redact(cfg.RedisPassword)
+	redacted.DenyWebhookURL = redact(cfg.DenyWebhookURL)
+	redacted.OIDC.ClientSecret = redact(cfg.OIDC.ClientSecret)
+	redacted.GitHub.ClientSecret = redact(cfg.GitHub.ClientSecret)
+	return redacted
+}
+
+// validate reports the first invalid setting.
+func (cfg *Config) validate() error {
+	if err := validateListenAddr(cfg.ListenAddr); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", cfg.ListenAddr, err)
+	}
+
+	if cfg.BasePath != "" && !strings.HasPrefix(cfg.BasePath, "/") {
+		return fmt.Errorf("base path %q must start with a slash", cfg.BasePath)
+	}
+
+	if cfg.PprofAddr != "" {
+		if err := validateListenAddr(cfg.PprofAddr); err != nil {
+			return fmt.Errorf("invalid pprof address %q: %w", cfg.PprofAddr, err)
+		}
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return errors.New("TLS certificate and key files must be set together")
+	}
+
+	switch cfg.ClientCertAuth {
+	case "":
+	case clientCertAuthHeader:
+		if len(cfg.TrustedProxies) == 0 {
+			return errors.New("trusted proxies are required with header client certificate auth, as only they may set the certificate header")
+		}
+	case clientCertAuthTLS:
+		if !cfg.TLSEnabled() || cfg.ClientCAFile == "" {
+			return errors.New("TLS certificate, key and client CA files are required with tls client certificate auth")
+		}
+	default:
+		return fmt.Errorf("unknown client certificate auth mode %q, expected %q or %q", cfg.ClientCertAuth, clientCertAuthTLS, clientCertAuthHeader)
+	}
+
+	// Skipping verification is for local clusters only, refuse it alongside
+	// settings meant for a real deployment
+	if cfg.InsecureSkipTLSVerify {
+		if cfg.CAFile != "" {
+			return errors.New("skipping TLS verification can't be combined with a CA file")
+		}
+		if cfg.CookieSecure {
+			return errors.New("skipping TLS verification is only allowed for development with secure cookies disabled")
+		}
+	}
+
+	if len(cfg.SessionSecret) < minSessionSecretLength {
+		return fmt.Errorf("session secret must be set to at least %d bytes", minSessionSecretLength)
+	}
+	if cfg.SessionSecretPrevious != "" && len(cfg.SessionSecretPrevious) < minSessionSecretLength {
+		return fmt.Errorf("previous session secret must be at least %d bytes", minSessionSecretLength)
+	}
+
+	switch cfg.SessionBackend {
+	case sessionBackendCookie, sessionBackendMemory:
+	case sessionBackendRedis:
+		if cfg.RedisAddr == "" {
+			return errors.New("Redis address is required with the redis session backend")
+		}
+	default:
+		return fmt.Errorf("unknown session backend %q, expected %q, %q or %q", cfg.SessionBackend, sessionBackendCookie, sessionBackendMemory, sessionBackendRedis)
+	}
+
+	switch cfg.AppEnv {
+	case appEnvProduction, appEnvDevelopment:
+	default:
+		return fmt.Errorf("unknown app environment %q, expected %q or %q", cfg.AppEnv, appEnvProduction, appEnvDevelopment)
+	}
+	switch cfg.GinMode {
+	case "", gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		return fmt.Errorf("unknown gin mode %q, expected %q, %q or %q", cfg.GinMode, gin.DebugMode, gin.ReleaseMode, gin.TestMode)
+	}
+
+	// Cookie names are HTTP tokens, which exclude separators and spaces
+	if cfg.SessionCookieName == "" || hasControlChars(cfg.SessionCookieName) || strings.ContainsAny(cfg.SessionCookieName, " \t()<>@,;:\\\"/[]?={}") {
+		return fmt.Errorf("session cookie name %q must be a non-empty name without spaces or separators", cfg.SessionCookieName)
+	}
+
+	roles := map[string][]string{
+		"access role":      cfg.RequiredRoles,
+		"required binding": cfg.RequiredBindings,
+		"admin role":       cfg.AdminRoles,
+	}
+	for name, values := range roles {
+		for _, role := range values {
+			if role == "" || hasControlChars(role) {
+				return fmt.Errorf("%s %q must be a non-empty name without control characters", name, role)
+			}
+		}
+	}
+
+	if _, err := newRoleMatcher(cfg.AuthzMatchMode, cfg.RequiredRoles); err != nil {
+		return err
+	}
+
+	if cfg.AccessResource == "" && (cfg.AccessAPIGroup != "" || cfg.AccessNamespace != "" || cfg.AccessName != "") {
+		return errors.New("access API group, namespace and name require an access resource")
+	}
+
+	for _, binding := range cfg.RequiredBindings {
+		if strings.Count(binding, "/") > 1 || strings.HasPrefix(binding, "/") || strings.HasSuffix(binding, "/") {
+			return fmt.Errorf("required binding %q must be a ClusterRoleBinding name or a RoleBinding namespace/name", binding)
+		}
+	}
+
+	durations := map[string]time.Duration{
+		"session max age":   cfg.SessionMaxAge,
+		"API timeout":       cfg.APITimeout,
+		"request timeout":   cfg.RequestTimeout,
+		"cluster timeout":   cfg.ClusterTimeout,
+		"readiness timeout": cfg.ReadinessTimeout,
+		"shutdown timeout":  cfg.ShutdownTimeout,
+	}
+	for name, value := range durations {
+		if value <= 0 {
+			return fmt.Errorf("%s must be a positive duration", name)
+		}
+	}
+
+	if cfg.DiscoveryAttempts < 1 {
+		return errors.New("discovery max attempts must be at least 1")
+	}
+
+	if cfg.ClusterConcurrency < 1 {
+		return errors.New("cluster concurrency must be at least 1")
+	}
+
+	if cfg.KubeQPS <= 0 || cfg.KubeBurst < 1 {
+		return errors.New("Kubernetes client QPS and burst must be positive")
+	}
+
+	if cfg.DenyWebhookURL != "" && !strings.HasPrefix(cfg.DenyWebhookURL, "http://") && !strings.HasPrefix(cfg.DenyWebhookURL, "https://") {
+		return fmt.Errorf("deny webhook URL %q must start with http:// or https://", cfg.DenyWebhookURL)
+	}
+
+	if cfg.SessionIdleTimeout < 0 {
+		return errors.New("session idle timeout must not be negative")
+	}
+
+	if cfg.AuthzCacheTTL < 0 {
+		return errors.New("authorization cache TTL must not be negative")
+	}
+
+	if cfg.RateLimitRPS < 0 {
+		return errors.New("rate limit must not be negative")
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("trusted proxy %q must be an IP address or CIDR range", proxy)
+		}
+	}
+
+	for _, origin := range cfg.CORSAllowedOrigins {
+		// A wildcard can't be combined with credentials
+		if origin == "*" {
+			return errors.New("CORS allowed origins must be listed explicitly, not as *")
+		}
+		if !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			return fmt.Errorf("CORS allowed origin %q must start with http:// or https://", origin)
+		}
+	}
+
+	if cfg.OIDC.IssuerURL != "" && (cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "") {
+		return errors.New("OIDC client ID and redirect URL are required when an OIDC issuer is set")
+	}
+
+	if cfg.GitHub.ClientID != "" && (cfg.GitHub.ClientSecret == "" || cfg.GitHub.RedirectURL == "") {
+		return errors.New("GitHub client secret and redirect URL are required when a GitHub client ID is set")
+	}
+	if cfg.GitHub.ClientID != "" && cfg.GitHub.Org == "" && len(cfg.GitHub.Teams) == 0 {
+		return errors.New("GitHub org or teams are required when a GitHub client ID is set, otherwise every GitHub account could log in")
+	}
+	for _, team := range cfg.GitHub.Teams {
+		org, _, ok := strings.Cut(team, ":")
+		if !ok {
+			return fmt.Errorf("GitHub team %q must be named org:team-slug", team)
+		}
+		if cfg.GitHub.Org != "" && !strings.EqualFold(org, cfg.GitHub.Org) {
+			return fmt.Errorf("GitHub team %q is not in the GitHub org %q", team, cfg.GitHub.Org)
+		}
+	}
+
+	return nil
+}
+
+// envString reads a string environment variable, returning def when it is unset.
+func envString(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// splitList splits a comma-separated value, trimming whitespace and dropping
+// empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envList reads a comma-separated environment variable, returning def when it
+// is unset.
+func envList(name string, def []string) []string {
+	if value := os.Getenv(name); value != "" {
+		return splitList(value)
+	}
+	return def
+}
+
+// envReader parses typed environment variables, remembering the first
+// invalid value so it can be reported once.
+type envReader struct {
+	err error
+}
+
+// bool reads a boolean environment variable, returning def when it is unset.
+func (r *envReader) bool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		r.fail(fmt.Errorf("invalid value %q for %s: %w", value, name, err))
+		return def
+	}
+	return parsed
+}
+
+// int reads an integer environment variable, returning def when it is unset.
+func (r *envReader) int(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		r.fail(fmt.Errorf("invalid value %q for %s: %w", value, name, err))
+		return def
+	}
+	return parsed
+}
+
+// float reads a floating point environment variable, returning def when it is
+// unset.
+func (r *envReader) float(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		r.fail(fmt.Errorf("invalid value %q for %s: %w", value, name, err))
+		return def
+	}
+	return parsed
+}
+
+// secret reads a secret from the environment variable name or, following the
+// Docker and Kubernetes secret convention, from the file named by name_FILE,
+// such as a mounted Secret volume. It returns def when neither is set.
+func (r *envReader) secret(name, def string) string {
+	value := os.Getenv(name)
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return envString(name, def)
+	}
+	if value != "" {
+		r.fail(fmt.Errorf("only one of %s and %s_FILE may be set", name, name))
+		return def
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		r.fail(fmt.Errorf("failed to read %s_FILE: %w", name, err))
+		return def
+	}
+	// Files written by editors and echo end in a newline
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// duration reads a duration environment variable such as "30s" or "8h",
+// returning def when it is unset.
+func (r *envReader) duration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		r.fail(fmt.Errorf("invalid value %q for %s: %w", value, name, err))
+		return def
+	}
+	return parsed
+}
+
+func (r *envReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// validateListenAddr checks that addr is a "host:port" address with a valid
+// port. The host may be empty to listen on all interfaces.
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 0 || number > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
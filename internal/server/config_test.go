@@ -0,0 +1,48 @@
+package server
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLoadConfigRequiredRoles(t *testing.T) {
+	tests := []struct {
+		name         string
+		accessRole   string
+		requiredRole string
+		want         []string
+	}{
+		{name: "ACCESS_ROLE", accessRole: "viewer, editor", want: []string{"viewer", "editor"}},
+		{name: "REQUIRED_ROLE alias", requiredRole: "viewer,editor", want: []string{"viewer", "editor"}},
+		{name: "ACCESS_ROLE wins over REQUIRED_ROLE", accessRole: "viewer", requiredRole: "editor", want: []string{"viewer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SESSION_SECRET", testSessionSecret)
+			t.Setenv("ACCESS_ROLE", tt.accessRole)
+			t.Setenv("REQUIRED_ROLE", tt.requiredRole)
+
+			cfg, err := LoadConfig("")
+			if err != nil {
+				t.Fatalf("LoadConfig() failed: %v", err)
+			}
+			if !slices.Equal(cfg.RequiredRoles, tt.want) {
+				t.Errorf("RequiredRoles = %q, want %q", cfg.RequiredRoles, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRequiredBindings(t *testing.T) {
+	t.Setenv("SESSION_SECRET", testSessionSecret)
+	t.Setenv("REQUIRED_BINDING", "platform-access, team-a/app-access")
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if want := []string{"platform-access", "team-a/app-access"}; !slices.Equal(cfg.RequiredBindings, want) {
+		t.Errorf("RequiredBindings = %q, want %q", cfg.RequiredBindings, want)
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// corsMaxAge is how long browsers may cache a preflight response.
+const corsMaxAge = 12 * time.Hour
+
+// apiCORS lets frontends served from origins call the JSON API from the
+// browser, sending the session cookie along. Preflight requests are answered
+// before they reach authentication.
+func apiCORS(origins []string) gin.HandlerFunc {
+	return cors.New(cors.Config{
+		AllowOrigins:     origins,
+		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
+		AllowHeaders:     []string{"Authorization", "Content-Type", requestIDHeader},
+		ExposeHeaders:    []string{requestIDHeader, "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           corsMaxAge,
+	})
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// csrfFormField is the form field, and csrfHeader the header, carrying the
+// CSRF token on state-changing requests.
+const (
+	csrfFormField = "csrf_token"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// csrfToken returns the session's CSRF token, creating it on first use. The
+// session must be saved for a new token to persist.
+func csrfToken(session sessions.Session) (string, error) {
+	if token, ok := session.Get("csrf_token").(string); ok && token != "" {
+		return token, nil
+	}
+
+	token, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	session.Set("csrf_token", token)
+	return token, nil
+}
+
+// csrfProtect rejects state-changing requests whose CSRF token does not match
+// the one stored in the session.
+func csrfProtect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		expected, _ := sessions.Default(c).Get("csrf_token").(string)
+		submitted := c.PostForm(csrfFormField)
+		if submitted == "" {
+			submitted = c.GetHeader(csrfHeader)
+		}
+
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(submitted)) != 1 {
+			respondError(c, http.StatusForbidden, codeInvalidCSRFToken, "Invalid CSRF token")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// authzExplanation describes how the authorization check of a user went, for
+// admins debugging denials.
+type authzExplanation struct {
+	User          string   `json:"user"`
+	Kind          string   `json:"kind"`
+	Groups        []string `json:"groups"`
+	RequiredRoles []string `json:"requiredRoles,omitempty"`
+	// RequiredBindings are ClusterRoleBinding names and RoleBinding
+	// namespace/names
+	RequiredBindings []string `json:"requiredBindings,omitempty"`
+	AccessVerb       string   `json:"accessVerb,omitempty"`
+	AccessResource   string   `json:"accessResource,omitempty"`
+	AccessAPIGroup   string   `json:"accessAPIGroup,omitempty"`
+	AccessNamespace  string   `json:"accessNamespace,omitempty"`
+	AccessName       string   `json:"accessName,omitempty"`
+
+	// The number of bindings looked at, and those that either are required,
+	// reference a required role or have the user as a subject
+	ClusterRoleBindingsScanned int                  `json:"clusterRoleBindingsScanned"`
+	RoleBindingsScanned        int                  `json:"roleBindingsScanned"`
+	RoleBindingsHidden         bool                 `json:"roleBindingsHidden,omitempty"`
+	Bindings                   []bindingExplanation `json:"bindings"`
+
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+// bindingExplanation is a binding relevant to a user's authorization: whether
+// it or its role is required, and which of its subjects match the user.
+type bindingExplanation struct {
+	Kind            string           `json:"kind"`
+	Name            string           `json:"name"`
+	Namespace       string           `json:"namespace,omitempty"`
+	Role            string           `json:"role"`
+	RequiredRole    bool             `json:"requiredRole"`
+	RequiredBinding bool             `json:"requiredBinding"`
+	Subjects        []rbacv1.Subject `json:"subjects"`
+	MatchedSubjects []rbacv1.Subject `json:"matchedSubjects"`
+}
+
+// explainAuthz runs the same checks as authorize for id, without the cache,
+// recording every binding that bears on the decision and why the decision
+// was made.
+func (s *Server) explainAuthz(ctx context.Context, clientset kubernetes.Interface, id identity) (*authzExplanation, *httpError) {
+	logger := requestLog(ctx)
+	explanation := &authzExplanation{
+		User:             id.User,
+		Kind:             id.Kind,
+		Groups:           id.Groups,
+		RequiredRoles:    s.cfg.RequiredRoles,
+		RequiredBindings: s.cfg.RequiredBindings,
+		Bindings:         []bindingExplanation{},
+	}
+
+	if !s.userAllowed(id.User) {
+		explanation.Reason = fmt.Sprintf("Denied: %s is not listed in ALLOWED_USERS, so RBAC was not checked.", id.User)
+		return explanation, nil
+	}
+
+	if s.cfg.AccessResource != "" {
+		explanation.AccessVerb = s.cfg.AccessVerb
+		explanation.AccessResource = s.cfg.AccessResource
+		explanation.AccessAPIGroup = s.cfg.AccessAPIGroup
+		explanation.AccessNamespace = s.cfg.AccessNamespace
+		explanation.AccessName = s.cfg.AccessName
+		allowed, err := canAccess(ctx, clientset, s.cfg, id)
+		if err != nil {
+			logger.Error("Failed to create SubjectAccessReview", "context", id.Context, "user", id.User, "error", err)
+			return nil, kubeAPIError(err, "Failed to review access")
+		}
+		explanation.Allowed = allowed
+		explanation.Reason = fmt.Sprintf("Denied: the API server's SubjectAccessReview does not allow %s to %s.", id.User, describeAccess(s.cfg))
+		if allowed {
+			explanation.Reason = fmt.Sprintf("Allowed: the API server's SubjectAccessReview allows %s to %s.", id.User, describeAccess(s.cfg))
+		}
+		return explanation, nil
+	}
+
+	var grantedBy *bindingExplanation
+	explain := func(binding bindingExplanation) {
+		binding.RequiredRole = s.requiredRoles.matches(binding.Role)
+		binding.RequiredBinding = s.requiredBinding(binding.Namespace, binding.Name)
+		required := binding.RequiredRole || binding.RequiredBinding
+		binding.MatchedSubjects = []rbacv1.Subject{}
+		for _, subject := range binding.Subjects {
+			if s.subjects.matches(subject, id) {
+				binding.MatchedSubjects = append(binding.MatchedSubjects, subject)
+			}
+		}
+		if !required && len(binding.MatchedSubjects) == 0 {
+			return
+		}
+		explanation.Bindings = append(explanation.Bindings, binding)
+		if grantedBy == nil && required && len(binding.MatchedSubjects) > 0 {
+			grantedBy = &binding
+		}
+	}
+
+	err := s.eachClusterRoleBinding(ctx, clientset, id.Context, func(crb rbacv1.ClusterRoleBinding) bool {
+		explanation.ClusterRoleBindingsScanned++
+		explain(bindingExplanation{Kind: "ClusterRoleBinding", Name: crb.Name, Role: crb.RoleRef.Name, Subjects: crb.Subjects})
+		return true
+	})
+	if err != nil {
+		logger.Error("Failed to list ClusterRoleBindings", "context", id.Context, "error", err)
+		return nil, kubeAPIError(err, "Failed to list ClusterRoleBindings")
+	}
+
+	err = eachRoleBinding(ctx, clientset, s.cfg.TargetNamespace, func(rb rbacv1.RoleBinding) bool {
+		explanation.RoleBindingsScanned++
+		explain(bindingExplanation{Kind: "RoleBinding", Name: rb.Name, Namespace: rb.Namespace, Role: rb.RoleRef.Name, Subjects: rb.Subjects})
+		return true
+	})
+	explanation.RoleBindingsHidden = apierrors.IsForbidden(err)
+	if err != nil && !explanation.RoleBindingsHidden {
+		logger.Error("Failed to list RoleBindings", "context", id.Context, "error", err)
+		return nil, kubeAPIError(err, "Failed to list RoleBindings")
+	}
+
+	explanation.Allowed = grantedBy != nil
+	explanation.Reason = explainReason(explanation, grantedBy)
+	return explanation, nil
+}
+
+// explainReason summarizes why an explained check was allowed or denied.
+func explainReason(explanation *authzExplanation, grantedBy *bindingExplanation) string {
+	if grantedBy != nil {
+		where := "cluster-wide"
+		if grantedBy.Namespace != "" {
+			where = "in namespace " + grantedBy.Namespace
+		}
+		subject := grantedBy.MatchedSubjects[0]
+		if !grantedBy.RequiredRole {
+			return fmt.Sprintf("Allowed: the required binding %s %s %s has %s %s as a subject.", grantedBy.Kind, grantedBy.Name, where, subject.Kind, subject.Name)
+		}
+		return fmt.Sprintf("Allowed: %s %s binds %s %s to the required role %s %s.", grantedBy.Kind, grantedBy.Name, subject.Kind, subject.Name, grantedBy.Role, where)
+	}
+	if len(explanation.RequiredRoles) == 0 && len(explanation.RequiredBindings) == 0 {
+		return "Denied: no required roles or bindings are configured with ACCESS_ROLE or REQUIRED_BINDING."
+	}
+
+	required := 0
+	for _, binding := range explanation.Bindings {
+		if binding.RequiredRole || binding.RequiredBinding {
+			required++
+		}
+	}
+	wanted := strings.Join(append(slices.Clone(explanation.RequiredRoles), explanation.RequiredBindings...), ", ")
+	if required == 0 {
+		reason := fmt.Sprintf("Denied: no binding is or references the required roles and bindings %s. Check their names.", wanted)
+		if explanation.RoleBindingsHidden {
+			reason += " RoleBindings could not be listed, so only ClusterRoleBindings were checked."
+		}
+		return reason
+	}
+	return fmt.Sprintf("Denied: %d bindings are or reference the required roles and bindings %s, but none has %s %s or one of its groups as a subject. Check the subject kinds and names.", required, wanted, explanation.Kind, explanation.User)
+}
+
+// handleDebugAuthz explains to an admin why the user named by the user query
+// parameter, with any extra group parameters, is allowed or denied.
+func (s *Server) handleDebugAuthz(c *gin.Context) {
+	admin, clientset, clientErr := s.requestClient(c)
+	if clientErr != nil {
+		respondHTTPError(c, clientErr)
+		return
+	}
+
+	user := c.Query("user")
+	if user == "" {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "The user query parameter is required")
+		return
+	}
+	if err := validateInput("user query parameter", user); err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+	if err := validateInput("group query parameter", c.QueryArray("group")...); err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	if len(s.adminRoles) == 0 {
+		respondError(c, http.StatusForbidden, codeForbidden, "Debugging authorization requires ADMIN_ROLE to be set")
+		return
+	}
+	isAdmin, adminErr := s.isAdmin(ctx, clientset, admin)
+	if adminErr != nil {
+		respondHTTPError(c, adminErr)
+		return
+	}
+	if !isAdmin {
+		respondError(c, http.StatusForbidden, codeForbidden, "Only admins may debug authorization")
+		return
+	}
+
+	id := actingIdentity(admin, user)
+	id.Groups = append(id.Groups, c.QueryArray("group")...)
+
+	explanation, err := s.explainAuthz(ctx, clientset, id)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	requestLog(ctx).Info("Explained authorization decision", "user", admin.User, "explained_user", user, "decision", authzDecision(explanation.Allowed))
+	c.JSON(http.StatusOK, explanation)
+}
+
+// handleConfig shows an admin the effective configuration, after the config
+// file and environment variables were applied, with its secrets redacted.
+func (s *Server) handleConfig(c *gin.Context) {
+	admin, clientset, clientErr := s.requestClient(c)
+	if clientErr != nil {
+		respondHTTPError(c, clientErr)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	if len(s.adminRoles) == 0 {
+		respondError(c, http.StatusForbidden, codeForbidden, "Viewing the configuration requires ADMIN_ROLE to be set")
+		return
+	}
+	isAdmin, adminErr := s.isAdmin(ctx, clientset, admin)
+	if adminErr != nil {
+		respondHTTPError(c, adminErr)
+		return
+	}
+	if !isAdmin {
+		respondError(c, http.StatusForbidden, codeForbidden, "Only admins may view the configuration")
+		return
+	}
+
+	requestLog(ctx).Info("Showed configuration", "user", admin.User)
+	c.JSON(http.StatusOK, s.cfg.redacted())
+}
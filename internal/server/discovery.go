@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Backoff between attempts of the version call, doubling from the initial
+// delay.
+const (
+	discoveryRetryDelay  = 200 * time.Millisecond
+	discoveryRetryFactor = 2.0
+	discoveryRetryJitter = 0.1
+)
+
+// serverVersion gets the API server's version, retrying transient failures
+// such as an API server that is still starting with exponential backoff, up
+// to attempts calls in total or until ctx is done.
+func serverVersion(ctx context.Context, clientset kubernetes.Interface, attempts int) (*version.Info, error) {
+	backoff := wait.Backoff{
+		Duration: discoveryRetryDelay,
+		Factor:   discoveryRetryFactor,
+		Jitter:   discoveryRetryJitter,
+		Steps:    attempts,
+	}
+
+	var info *version.Info
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		info, lastErr = getServerVersion(ctx, clientset)
+		if lastErr == nil {
+			return true, nil
+		}
+		if !isTransient(lastErr) {
+			return false, lastErr
+		}
+		requestLog(ctx).Debug("Transient failure of the Kubernetes API version call", "error", lastErr)
+		return false, nil
+	})
+	if err != nil && lastErr != nil {
+		// Report why the API server failed rather than that we gave up
+		return nil, lastErr
+	}
+	return info, err
+}
+
+// getServerVersion makes one version call within ctx. Discovery's
+// ServerVersion takes no context, and the cached clientsets have no client
+// timeout, so the request is made with the discovery REST client instead.
+// Clientsets without one, such as client-go's fake, use ServerVersion.
+func getServerVersion(ctx context.Context, clientset kubernetes.Interface) (*version.Info, error) {
+	client := clientset.Discovery().RESTClient()
+	if client == nil {
+		return clientset.Discovery().ServerVersion()
+	}
+
+	body, err := client.Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+	var info version.Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse the Kubernetes API version: %w", err)
+	}
+	return &info, nil
+}
+
+// isTransient reports whether err is a failure that may go away on retry: the
+// API server refusing connections, timing out, or reporting that it is
+// unavailable or overloaded.
+func isTransient(err error) bool {
+	if apierrors.IsServiceUnavailable(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) || apierrors.IsInternalError(err) {
+		return true
+	}
+	if utilnet.IsConnectionRefused(err) || utilnet.IsConnectionReset(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
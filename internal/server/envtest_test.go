@@ -0,0 +1,193 @@
+//go:build envtest
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// The tests in this file run against a real API server and etcd started by
+// envtest, so they only build with the envtest tag. The control plane
+// binaries are found through KUBEBUILDER_ASSETS:
+//
+//	KUBEBUILDER_ASSETS=$(setup-envtest use -p path 1.30.x) go test -tags envtest ./internal/server/
+
+// envtestViewerRole is the ClusterRole the envtest cluster requires access by.
+const envtestViewerRole = "kubeauth-viewer"
+
+// envtestUsers are the users of the envtest kubeconfig, each with a context
+// of their own name:
+//   - alice is in the developers group, bound to envtestViewerRole by a
+//     ClusterRoleBinding;
+//   - bob is bound to it by a RoleBinding in the team-a namespace;
+//   - carol holds no binding of it.
+var envtestUsers = []envtest.User{
+	{Name: "alice", Groups: []string{"developers"}},
+	{Name: "bob"},
+	{Name: "carol", Groups: []string{"testers"}},
+}
+
+// startControlPlane starts an envtest control plane for the duration of the
+// test and returns the admin config of its API server.
+func startControlPlane(t *testing.T) (*envtest.Environment, *rest.Config) {
+	t.Helper()
+
+	env := &envtest.Environment{}
+	restConfig, err := env.Start()
+	if err != nil {
+		t.Fatalf("failed to start the envtest control plane, is KUBEBUILDER_ASSETS set? %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("failed to stop the envtest control plane: %v", err)
+		}
+	})
+	return env, restConfig
+}
+
+// createRBAC creates the roles and bindings envtestUsers are described with.
+// Every authenticated user may read the bindings, which the server lists with
+// the credentials of the selected context.
+func createRBAC(t *testing.T, clientset kubernetes.Interface) {
+	t.Helper()
+	ctx := context.Background()
+
+	clusterRoles := []*rbacv1.ClusterRole{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "kubeauth-binding-reader"},
+			Rules: []rbacv1.PolicyRule{{
+				APIGroups: []string{rbacv1.GroupName},
+				Resources: []string{"clusterrolebindings", "rolebindings"},
+				Verbs:     []string{"get", "list", "watch"},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: envtestViewerRole},
+			Rules: []rbacv1.PolicyRule{{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list"},
+			}},
+		},
+	}
+	for _, clusterRole := range clusterRoles {
+		if _, err := clientset.RbacV1().ClusterRoles().Create(ctx, clusterRole, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("failed to create ClusterRole %s: %v", clusterRole.Name, err)
+		}
+	}
+
+	clusterRoleBindings := []*rbacv1.ClusterRoleBinding{
+		clusterRoleBinding("authenticated-binding-reader", "kubeauth-binding-reader", groupSubject("system:authenticated")),
+		clusterRoleBinding("developers-viewer", envtestViewerRole, groupSubject("developers")),
+	}
+	for _, binding := range clusterRoleBindings {
+		if _, err := clientset.RbacV1().ClusterRoleBindings().Create(ctx, binding, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("failed to create ClusterRoleBinding %s: %v", binding.Name, err)
+		}
+	}
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	if _, err := clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create namespace %s: %v", namespace.Name, err)
+	}
+	binding := roleBinding("team-a", "bob-viewer", envtestViewerRole, userSubject("bob"))
+	if _, err := clientset.RbacV1().RoleBindings("team-a").Create(ctx, binding, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create RoleBinding %s: %v", binding.Name, err)
+	}
+}
+
+// writeEnvtestKubeConfig provisions users on the control plane of env and
+// writes a kubeconfig with a context of each user's name, authenticating
+// with their client certificate, returning its path.
+func writeEnvtestKubeConfig(t *testing.T, env *envtest.Environment, users []envtest.User) string {
+	t.Helper()
+
+	kubeConfig := clientcmdapi.NewConfig()
+	for _, user := range users {
+		authenticated, err := env.AddUser(user, nil)
+		if err != nil {
+			t.Fatalf("failed to provision envtest user %s: %v", user.Name, err)
+		}
+		userConfig := authenticated.Config()
+
+		kubeConfig.Clusters["envtest"] = &clientcmdapi.Cluster{
+			Server:                   userConfig.Host,
+			CertificateAuthorityData: userConfig.CAData,
+		}
+		kubeConfig.AuthInfos[user.Name] = &clientcmdapi.AuthInfo{
+			ClientCertificateData: userConfig.CertData,
+			ClientKeyData:         userConfig.KeyData,
+		}
+		kubeConfig.Contexts[user.Name] = &clientcmdapi.Context{Cluster: "envtest", AuthInfo: user.Name}
+	}
+	kubeConfig.CurrentContext = users[0].Name
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := clientcmd.WriteToFile(*kubeConfig, path); err != nil {
+		t.Fatalf("failed to write envtest kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestEnvtestHome(t *testing.T) {
+	env, restConfig := startControlPlane(t)
+	admin, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		t.Fatalf("failed to create admin clientset: %v", err)
+	}
+	createRBAC(t, admin)
+	kubeConfigPath := writeEnvtestKubeConfig(t, env, envtestUsers)
+
+	// Access is decided by the bindings of envtestViewerRole, or by a
+	// SelfSubjectAccessReview of listing pods in team-a, which the same
+	// bindings grant
+	modes := []struct {
+		name      string
+		configure func(*Config)
+	}{
+		{name: "required role", configure: func(cfg *Config) { cfg.RequiredRoles = []string{envtestViewerRole} }},
+		{name: "access review", configure: func(cfg *Config) {
+			cfg.AccessResource, cfg.AccessVerb, cfg.AccessNamespace = "pods", "list", "team-a"
+		}},
+	}
+
+	tests := []struct {
+		context  string
+		wantCode int
+	}{
+		{context: "alice", wantCode: http.StatusOK},
+		{context: "bob", wantCode: http.StatusOK},
+		{context: "carol", wantCode: http.StatusForbidden},
+	}
+
+	for _, mode := range modes {
+		for _, tt := range tests {
+			t.Run(mode.name+"/"+tt.context, func(t *testing.T) {
+				cfg := testConfig(t)
+				cfg.KubeConfigPath = kubeConfigPath
+				mode.configure(&cfg)
+				client := newTestClient(t, newTestServer(t, cfg, nil))
+
+				client.login(tt.context)
+				for _, path := range []string{"/home", "/api/v1/home"} {
+					resp, body := client.get(path, nil)
+					if resp.StatusCode != tt.wantCode {
+						t.Errorf("GET %s as %s returned %d, want %d:\n%s", path, tt.context, resp.StatusCode, tt.wantCode, body)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Machine-readable error codes returned alongside error messages.
+const (
+	codeBadRequest        = "bad_request"
+	codeUnauthenticated   = "unauthenticated"
+	codeForbidden         = "forbidden"
+	codeInvalidCSRFToken  = "invalid_csrf_token"
+	codeUnsupportedMedia  = "unsupported_media_type"
+	codeRateLimited       = "rate_limited"
+	codeInternal          = "internal"
+	codeKubeAPITimeout    = "kube_api_timeout"
+	codeRequestTimeout    = "request_timeout"
+	codeKubeCredentials   = "kube_credentials_failed"
+	codeKubeUnreachable   = "kube_api_unreachable"
+	codeLoginFailed       = "login_failed"
+	codeInvalidLoginState = "invalid_login_state"
+)
+
+// httpError is a failure to report to the client with the given HTTP status
+// and error code.
+type httpError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *httpError) Error() string {
+	return e.Message
+}
+
+// kubeAPIError converts a failed Kubernetes API call into the error shown to
+// the client, reporting a gateway timeout when the call ran out of time, and a
+// bad gateway when the context's credentials couldn't be obtained or were
+// rejected.
+func kubeAPIError(err error, message string) *httpError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &httpError{http.StatusGatewayTimeout, codeKubeAPITimeout, "Timed out waiting for the Kubernetes API"}
+	}
+	if reason, ok := credentialsError(err); ok {
+		return &httpError{http.StatusBadGateway, codeKubeCredentials, "Failed to get credentials for the Kubernetes API: " + reason}
+	}
+	if apierrors.IsUnauthorized(err) {
+		return &httpError{http.StatusBadGateway, codeKubeCredentials, "The Kubernetes API rejected the context's credentials"}
+	}
+	return &httpError{http.StatusInternalServerError, codeInternal, message}
+}
+
+// credentialsPrefix starts the errors of client-go's credential plugin
+// transport, such as an exec plugin that isn't installed or exits non-zero.
+const credentialsPrefix = "getting credentials: "
+
+// credentialsError returns why the credentials of a request couldn't be
+// obtained, if that's what err is. client-go doesn't wrap the plugin's error,
+// so it is recognized by its message.
+func credentialsError(err error) (string, bool) {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || urlErr.Err == nil {
+		return "", false
+	}
+	return strings.CutPrefix(urlErr.Err.Error(), credentialsPrefix)
+}
+
+// respondError aborts the request with an error. API routes, and clients that
+// prefer JSON over HTML, get {"error": {"code": ..., "message": ...}}; browsers
+// get the rendered error page.
+func respondError(c *gin.Context, status int, code, message string) {
+	// Whatever failed once the request ran out of time failed for that reason
+	if status >= http.StatusInternalServerError && requestTimedOut(c) {
+		status, code, message = http.StatusServiceUnavailable, codeRequestTimeout, "The request took too long to handle"
+	}
+
+	if wantsJSON(c) {
+		c.AbortWithStatusJSON(status, gin.H{"error": gin.H{"code": code, "message": message}})
+		return
+	}
+
+	c.HTML(status, "error.html", gin.H{
+		"Status":     status,
+		"StatusText": http.StatusText(status),
+		"Code":       code,
+		"Message":    message,
+	})
+	c.Abort()
+}
+
+// respondHTTPError aborts the request with err.
+func respondHTTPError(c *gin.Context, err *httpError) {
+	respondError(c, err.Status, err.Code, err.Message)
+}
+
+// jsonErrorsKey is the gin context key marking routes that only return JSON.
+const jsonErrorsKey = "json_errors"
+
+// jsonErrors makes the routes it guards report errors as JSON regardless of
+// the Accept header.
+func jsonErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(jsonErrorsKey, true)
+		c.Next()
+	}
+}
+
+// wantsJSON reports whether the error response to c should be JSON.
+func wantsJSON(c *gin.Context) bool {
+	if c.GetBool(jsonErrorsKey) {
+		return true
+	}
+	return c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// githubAPIURL is the base URL of the GitHub REST API.
+const githubAPIURL = "https://api.github.com"
+
+// githubPrefix starts the names of GitHub users and teams, so a GitHub
+// account can't pass for a cluster user or group of the same name, such as
+// "admin".
+const githubPrefix = "github:"
+
+// githubMaxPages bounds how many pages of teams are read for one login.
+const githubMaxPages = 10
+
+// githubProvider implements GitHub's OAuth2 login as an alternative to
+// selecting a kubeconfig context. Users are named "github:<login>" and their
+// teams become groups of the form "github:org:team-slug", which the cluster's
+// bindings can then name as User and Group subjects.
+type githubProvider struct {
+	oauth2Config oauth2.Config
+	org          string
+	teams        []string
+
+	// homePath is where users land once logged in
+	homePath string
+}
+
+// githubUser is the part of GitHub's /user response we use.
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+// githubTeam is the part of an entry of GitHub's /user/teams response we use.
+type githubTeam struct {
+	Slug         string `json:"slug"`
+	Organization struct {
+		Login string `json:"login"`
+	} `json:"organization"`
+}
+
+// newGitHubProvider returns the GitHub login for the app served at basePath.
+// It returns nil when GitHub login is not configured.
+func newGitHubProvider(cfg GitHubConfig, basePath string) *githubProvider {
+	if cfg.ClientID == "" {
+		return nil
+	}
+
+	return &githubProvider{
+		oauth2Config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     github.Endpoint,
+			Scopes:       []string{"read:user", "read:org"},
+		},
+		org:      cfg.Org,
+		teams:    cfg.Teams,
+		homePath: basePath + "/home",
+	}
+}
+
+// handleLogin starts the authorization code flow.
+func (p *githubProvider) handleLogin(c *gin.Context) {
+	logger := requestLog(c.Request.Context())
+	state, err := randomString()
+	if err != nil {
+		logger.Error("Failed to generate GitHub state", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to start login")
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("github_state", state)
+	if err := session.Save(); err != nil {
+		logger.Error("Failed to save session", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+		return
+	}
+
+	c.Redirect(http.StatusFound, p.oauth2Config.AuthCodeURL(state))
+}
+
+// handleCallback exchanges the authorization code, reads the user's login and
+// team memberships and stores them in the session as the user and groups.
+func (p *githubProvider) handleCallback(c *gin.Context) {
+	logger := requestLog(c.Request.Context())
+	session := sessions.Default(c)
+	state, _ := session.Get("github_state").(string)
+	session.Delete("github_state")
+
+	if state == "" || c.Query("state") != state {
+		respondError(c, http.StatusBadRequest, codeInvalidLoginState, "Invalid login state")
+		return
+	}
+	if errParam := c.Query("error"); errParam != "" {
+		logger.Warn("GitHub login failed", "error", errParam, "description", c.Query("error_description"))
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed")
+		return
+	}
+
+	token, err := p.oauth2Config.Exchange(c.Request.Context(), c.Query("code"))
+	if err != nil {
+		logger.Error("Failed to exchange GitHub code", "error", err)
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed")
+		return
+	}
+	client := p.oauth2Config.Client(c.Request.Context(), token)
+
+	var user githubUser
+	if err := p.get(c.Request.Context(), client, "/user", &user); err != nil || user.Login == "" {
+		logger.Error("Failed to read GitHub user", "error", err)
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed: could not read the GitHub user")
+		return
+	}
+
+	teams, err := p.userTeams(c.Request.Context(), client)
+	if err != nil {
+		logger.Error("Failed to read GitHub teams", "user", user.Login, "error", err)
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed: could not read the GitHub teams")
+		return
+	}
+
+	groups, ok := p.groups(teams)
+	if !ok {
+		logger.Warn("GitHub user is not a member of an allowed team", "user", user.Login)
+		respondError(c, http.StatusForbidden, codeForbidden, p.deniedMessage())
+		return
+	}
+
+	// The cluster is queried with the application's own credentials
+	if err := saveIdentity(session, identity{User: githubPrefix + user.Login, Groups: groups, Kind: rbacv1.UserKind}); err != nil {
+		logger.Error("Failed to save session", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+		return
+	}
+
+	logger.Info("GitHub login succeeded", "user", user.Login, "groups", groups)
+	c.Redirect(http.StatusFound, p.homePath)
+}
+
+// userTeams lists every team the token's user is a member of.
+func (p *githubProvider) userTeams(ctx context.Context, client *http.Client) ([]githubTeam, error) {
+	var teams []githubTeam
+	for page := 1; page <= githubMaxPages; page++ {
+		var batch []githubTeam
+		if err := p.get(ctx, client, fmt.Sprintf("/user/teams?per_page=100&page=%d", page), &batch); err != nil {
+			return nil, err
+		}
+		teams = append(teams, batch...)
+		if len(batch) < 100 {
+			break
+		}
+	}
+	return teams, nil
+}
+
+// groups maps the user's teams in the configured org to prefixed groups,
+// keeping only the configured teams when any are set. It reports false when
+// the user is in none of them, or not in the org at all.
+func (p *githubProvider) groups(teams []githubTeam) ([]string, bool) {
+	groups := []string{"system:authenticated"}
+	for _, team := range teams {
+		org := team.Organization.Login
+		if p.org != "" && !strings.EqualFold(org, p.org) {
+			continue
+		}
+		group := org + ":" + team.Slug
+		if len(p.teams) > 0 && !slices.ContainsFunc(p.teams, func(allowed string) bool { return strings.EqualFold(allowed, group) }) {
+			continue
+		}
+		groups = append(groups, githubPrefix+group)
+	}
+
+	// Config validation requires an org or teams, so no login is let in
+	// without a team
+	return groups, len(groups) > 1
+}
+
+// deniedMessage names the org or teams a GitHub user must belong to.
+func (p *githubProvider) deniedMessage() string {
+	if len(p.teams) > 0 {
+		return fmt.Sprintf("Login denied: you must be a member of one of the GitHub teams %s.", strings.Join(p.teams, ", "))
+	}
+	return fmt.Sprintf("Login denied: you must be a member of a team of the GitHub organization %s.", p.org)
+}
+
+// get decodes the JSON response of a GitHub API GET request into v.
+func (p *githubProvider) get(ctx context.Context, client *http.Client, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API %s returned %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,670 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// unknownVersion is shown when the cluster's version can't be determined.
+const unknownVersion = "unknown"
+
+// homeData holds the cluster details and bindings shown on the home page.
+// UserRoles are the distinct roles the user is bound to, and
+// RoleBindingsHidden is set when the user may not list RoleBindings.
+type homeData struct {
+	User                string                      `json:"user"`
+	ImpersonatedBy      string                      `json:"impersonatedBy,omitempty"`
+	Cluster             string                      `json:"cluster"`
+	GitVersion          string                      `json:"gitVersion"`
+	Platform            string                      `json:"platform"`
+	AccessNamespace     string                      `json:"accessNamespace,omitempty"`
+	UserRoles           []string                    `json:"userRoles"`
+	ClusterRoleBindings []rbacv1.ClusterRoleBinding `json:"clusterRoleBindings"`
+	RoleBindings        []rbacv1.RoleBinding        `json:"roleBindings"`
+	RoleBindingsHidden  bool                        `json:"roleBindingsHidden,omitempty"`
+}
+
+// selectContext authenticates the session as the user of the named context,
+// or as the pod's service account when running in-cluster.
+func (s *Server) selectContext(c *gin.Context, selectedContext string) *httpError {
+	logger := requestLog(c.Request.Context())
+	session := sessions.Default(c)
+
+	// In-cluster there is no context to pick, authenticate as the service account
+	if s.inClusterConfig != nil {
+		if err := saveIdentity(session, s.inClusterIdentity); err != nil {
+			logger.Error("Failed to save session", "error", err)
+			return &httpError{http.StatusInternalServerError, codeInternal, "Failed to save session"}
+		}
+		return nil
+	}
+
+	id, idErr := s.contextIdentity(c.Request.Context(), selectedContext)
+	if idErr != nil {
+		return idErr
+	}
+
+	if err := saveIdentity(session, id); err != nil {
+		logger.Error("Failed to save session", "error", err)
+		return &httpError{http.StatusInternalServerError, codeInternal, "Failed to save session"}
+	}
+
+	return nil
+}
+
+// contextIdentity returns the identity of the user of the named kubeconfig
+// context.
+func (s *Server) contextIdentity(ctx context.Context, contextName string) (identity, *httpError) {
+	if err := validateInput("context name", contextName); err != nil {
+		return identity{}, err
+	}
+
+	kubeConfig, _ := s.currentKubeConfig()
+	if len(kubeConfig.Contexts) == 0 {
+		return identity{}, &httpError{http.StatusBadRequest, codeBadRequest, "No kubeconfig file or contexts available to select."}
+	}
+
+	// Find the selected context details
+	kubeContext, ok := kubeConfig.Contexts[contextName]
+	if !ok {
+		return identity{}, &httpError{http.StatusBadRequest, codeBadRequest, "Unknown context selected."}
+	}
+
+	if err := s.contextError(contextName); err != nil {
+		return identity{}, &httpError{http.StatusBadRequest, codeBadRequest, fmt.Sprintf("The credentials of context %s can't be used: %v", contextName, err)}
+	}
+
+	// Service account contexts are identified by the account in their token
+	user, kind := kubeConfigIdentity(kubeConfig, kubeContext.AuthInfo)
+	groups := userGroups(kubeConfig, kubeContext.AuthInfo)
+	if namespace, _, ok := splitServiceAccountUsername(user); ok && kind == rbacv1.ServiceAccountKind {
+		groups = serviceAccountGroups(namespace)
+	} else if usesToken(kubeConfig, kubeContext.AuthInfo) {
+		// Any other token, such as a static or OIDC token, names its user
+		// only to the API server, not to the kubeconfig
+		if reviewed, ok := s.reviewSelf(ctx, contextName); ok {
+			user, groups = reviewed.Username, reviewed.Groups
+		}
+	}
+
+	// The kubeconfig is trusted, but a mangled entry would never match a subject
+	if err := validateInput(fmt.Sprintf("user of context %s", contextName), user); err != nil {
+		return identity{}, err
+	}
+	if err := validateInput(fmt.Sprintf("groups of context %s", contextName), groups...); err != nil {
+		return identity{}, err
+	}
+
+	return identity{
+		User:           user,
+		Groups:         groups,
+		Kind:           kind,
+		Context:        contextName,
+		Cluster:        kubeContext.Cluster,
+		OwnCredentials: true,
+	}, nil
+}
+
+// switchContext moves the logged in session to the named context when the
+// context's user is authorized there, and leaves it as it was otherwise.
+func (s *Server) switchContext(c *gin.Context, contextName string) *httpError {
+	logger := requestLog(c.Request.Context())
+
+	if s.inClusterConfig != nil {
+		return &httpError{http.StatusBadRequest, codeBadRequest, "There are no contexts to switch to in-cluster."}
+	}
+	if !s.canSwitchContext(c) {
+		return &httpError{http.StatusBadRequest, codeBadRequest, "Only sessions logged in with a kubeconfig context can switch contexts."}
+	}
+
+	id, idErr := s.contextIdentity(c.Request.Context(), contextName)
+	if idErr != nil {
+		return idErr
+	}
+
+	clientset, err := s.clientsets.Clientset(contextName)
+	if err != nil {
+		logger.Error("Failed to create Kubernetes clientset", "context", contextName, "error", err)
+		return &httpError{http.StatusInternalServerError, codeInternal, "Failed to create Kubernetes clientset"}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	result, authzErr := s.checkAccess(ctx, clientset, id)
+	if authzErr != nil {
+		return authzErr
+	}
+	if !result.Allowed {
+		return &httpError{http.StatusForbidden, codeForbidden, fmt.Sprintf("Not switching to context %s. %s", contextName, s.accessDeniedMessage(result))}
+	}
+
+	if err := saveIdentity(sessions.Default(c), id); err != nil {
+		logger.Error("Failed to save session", "error", err)
+		return &httpError{http.StatusInternalServerError, codeInternal, "Failed to save session"}
+	}
+
+	logger.Info("Switched context", "user", id.User, "context", contextName)
+	return nil
+}
+
+// requestClient returns who the request is authenticated as and the
+// clientset to make its Kubernetes API calls with: the bearer token's or
+// client certificate's, or the clientset of the session's selected context.
+func (s *Server) requestClient(c *gin.Context) (identity, kubernetes.Interface, *httpError) {
+	if auth, ok := c.Get(requestAuthKey); ok {
+		auth := auth.(*requestAuth)
+		return s.userMapping.apply(auth.id, s.subjects), auth.clientset, nil
+	}
+
+	// Unauthenticated is a 401, unlike a logged in user lacking access
+	session := sessions.Default(c)
+	if !isAuthenticated(session) {
+		return identity{}, nil, &httpError{http.StatusUnauthorized, codeUnauthenticated, "Not authenticated"}
+	}
+
+	// Retrieve minimal data from session
+	id := s.loginIdentity(session)
+
+	// Reuse the clientset for the selected context, building it on first use
+	clientset, err := s.clientsets.Clientset(id.Context)
+	if err != nil {
+		requestLog(c.Request.Context()).Error("Failed to create Kubernetes clientset", "context", id.Context, "error", err)
+		return identity{}, nil, &httpError{http.StatusInternalServerError, codeInternal, "Failed to create Kubernetes clientset"}
+	}
+	return id, clientset, nil
+}
+
+// loadHome authorizes the session's user and loads the bindings shown on the
+// home page.
+func (s *Server) loadHome(c *gin.Context) (*homeData, *httpError) {
+	logger := requestLog(c.Request.Context())
+
+	id, clientset, clientErr := s.requestClient(c)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+
+	// Bound all API calls so a hung API server can't block the handler
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	// Admins can check what another user would see, with their own clientset
+	if user := c.Query("impersonate"); user != "" {
+		id, clientErr = s.impersonate(ctx, id, clientset, user)
+		if clientErr != nil {
+			return nil, clientErr
+		}
+	}
+
+	result, authzErr := s.checkAccess(ctx, clientset, id)
+	if authzErr != nil {
+		return nil, authzErr
+	}
+	if !result.Allowed {
+		s.notifyDenied(id)
+		// Logged in but not authorized, name what access is missing
+		return nil, &httpError{http.StatusForbidden, codeForbidden, s.accessDeniedMessage(result)}
+	}
+
+	// Only show the user's own bindings unless configured to show all
+	crbs, err := s.userClusterRoleBindings(ctx, clientset, id, s.cfg.ShowAllBindings)
+	if err != nil {
+		logger.Error("Failed to list ClusterRoleBindings", "context", id.Context, "error", err)
+		return nil, kubeAPIError(err, "Failed to list ClusterRoleBindings")
+	}
+
+	// A restricted account may not list RoleBindings, show the rest anyway
+	namespace := s.roleBindingNamespace(c)
+	rbs, err := s.userRoleBindings(ctx, clientset, namespace, id, s.cfg.ShowAllBindings)
+	roleBindingsForbidden := apierrors.IsForbidden(err)
+	if roleBindingsForbidden {
+		logger.Warn("Not allowed to list RoleBindings", "context", id.Context, "namespace", namespace, "error", err)
+	} else if err != nil {
+		logger.Error("Failed to list RoleBindings", "context", id.Context, "error", err)
+		return nil, kubeAPIError(err, "Failed to list RoleBindings")
+	}
+
+	// The version is informational, so a failure doesn't fail the page
+	gitVersion, platform := unknownVersion, unknownVersion
+	version, err := serverVersion(ctx, clientset, s.cfg.DiscoveryAttempts)
+	if err != nil {
+		logger.Warn("Failed to get server version", "context", id.Context, "error", err)
+	} else {
+		gitVersion, platform = version.GitVersion, version.Platform
+	}
+
+	return &homeData{
+		User:                id.User,
+		ImpersonatedBy:      id.ImpersonatedBy,
+		Cluster:             id.Cluster,
+		GitVersion:          gitVersion,
+		Platform:            platform,
+		AccessNamespace:     result.Namespace,
+		UserRoles:           s.userRoles(crbs, rbs, id),
+		ClusterRoleBindings: crbs,
+		RoleBindings:        rbs,
+		RoleBindingsHidden:  roleBindingsForbidden,
+	}, nil
+}
+
+// userRoles returns the sorted names of the roles that crbs and rbs bind id
+// to. The bindings may include others' when all bindings are shown.
+func (s *Server) userRoles(crbs []rbacv1.ClusterRoleBinding, rbs []rbacv1.RoleBinding, id identity) []string {
+	roles := make(map[string]bool)
+	for _, crb := range crbs {
+		if s.subjects.hasSubject(crb.Subjects, id) {
+			roles[crb.RoleRef.Name] = true
+		}
+	}
+	for _, rb := range rbs {
+		if s.subjects.hasSubject(rb.Subjects, id) {
+			roles[rb.RoleRef.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// roleBindingsByNamespace groups rbs by their namespace. Templates range over
+// the namespaces in sorted order.
+func roleBindingsByNamespace(rbs []rbacv1.RoleBinding) map[string][]rbacv1.RoleBinding {
+	grouped := make(map[string][]rbacv1.RoleBinding)
+	for _, rb := range rbs {
+		grouped[rb.Namespace] = append(grouped[rb.Namespace], rb)
+	}
+	return grouped
+}
+
+// accessDeniedMessage explains why result denied the user and what access
+// they need to request.
+func (s *Server) accessDeniedMessage(result authzResult) string {
+	message := "Access denied: You are not authorized to view this page."
+	if result.Explanation != "" {
+		message += " " + result.Explanation
+	}
+	message += " The bindings you do have are listed on " + s.path("/my-access") + "."
+	if len(s.cfg.AllowedUsers) > 0 {
+		message += " Only users on the allowlist are let in."
+	}
+	switch {
+	case s.cfg.AccessResource != "":
+		return fmt.Sprintf("%s You need permission to %s.", message, describeAccess(s.cfg))
+	case len(s.cfg.RequiredBindings) > 0 && len(s.cfg.RequiredRoles) > 0:
+		return fmt.Sprintf("%s You need to be bound to one of the roles %s, or be a subject of one of the bindings %s.", message, strings.Join(s.cfg.RequiredRoles, ", "), strings.Join(s.cfg.RequiredBindings, ", "))
+	case len(s.cfg.RequiredBindings) > 0:
+		return fmt.Sprintf("%s You need to be a subject of one of the bindings %s.", message, strings.Join(s.cfg.RequiredBindings, ", "))
+	case len(s.cfg.RequiredRoles) == 1:
+		return fmt.Sprintf("%s You need to be bound to the %s role.", message, s.cfg.RequiredRoles[0])
+	case len(s.cfg.RequiredRoles) > 1:
+		return fmt.Sprintf("%s You need to be bound to one of the roles %s.", message, strings.Join(s.cfg.RequiredRoles, ", "))
+	}
+	return message
+}
+
+// accessData holds the bindings a user is a subject of, shown on /my-access.
+// RoleBindingsHidden is set when the user may not list RoleBindings.
+type accessData struct {
+	User                string                      `json:"user"`
+	Groups              []string                    `json:"groups"`
+	ClusterRoleBindings []rbacv1.ClusterRoleBinding `json:"clusterRoleBindings"`
+	RoleBindings        []rbacv1.RoleBinding        `json:"roleBindings"`
+	RoleBindingsHidden  bool                        `json:"roleBindingsHidden,omitempty"`
+}
+
+// loadMyAccess loads the bindings the session's user is a subject of. Unlike
+// the home page it doesn't require any role, so denied users can see what
+// access they do have.
+func (s *Server) loadMyAccess(c *gin.Context) (*accessData, *httpError) {
+	logger := requestLog(c.Request.Context())
+
+	id, clientset, clientErr := s.requestClient(c)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	crbs, err := s.userClusterRoleBindings(ctx, clientset, id, false)
+	if err != nil {
+		logger.Error("Failed to list ClusterRoleBindings", "context", id.Context, "error", err)
+		return nil, kubeAPIError(err, "Failed to list ClusterRoleBindings")
+	}
+
+	namespace := s.roleBindingNamespace(c)
+	rbs, err := s.userRoleBindings(ctx, clientset, namespace, id, false)
+	roleBindingsForbidden := apierrors.IsForbidden(err)
+	if roleBindingsForbidden {
+		logger.Warn("Not allowed to list RoleBindings", "context", id.Context, "namespace", namespace, "error", err)
+	} else if err != nil {
+		logger.Error("Failed to list RoleBindings", "context", id.Context, "error", err)
+		return nil, kubeAPIError(err, "Failed to list RoleBindings")
+	}
+
+	return &accessData{
+		User:                id.User,
+		Groups:              id.Groups,
+		ClusterRoleBindings: crbs,
+		RoleBindings:        rbs,
+		RoleBindingsHidden:  roleBindingsForbidden,
+	}, nil
+}
+
+// handleIndex displays the available contexts for the user to select,
+// narrowed down to those matching the q query parameter.
+func (s *Server) handleIndex(c *gin.Context) {
+	// A client certificate already says who the user is
+	if _, ok := c.Get(requestAuthKey); ok {
+		c.Redirect(http.StatusFound, s.path("/home"))
+		return
+	}
+
+	// In-cluster there is no context to pick, authenticate as the service account
+	if s.inClusterConfig != nil {
+		if err := s.selectContext(c, inClusterContext); err != nil {
+			respondHTTPError(c, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.path("/home"))
+		return
+	}
+
+	_, contexts := s.currentKubeConfig()
+	if len(contexts) > 0 {
+		session := sessions.Default(c)
+		token, err := csrfToken(session)
+		if err == nil {
+			err = session.Save()
+		}
+		if err != nil {
+			requestLog(c.Request.Context()).Error("Failed to create CSRF token", "error", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+			return
+		}
+
+		// Preselect the context the session is already using
+		var selected string
+		if isAuthenticated(session) {
+			selected = sessionIdentity(session).Context
+		}
+
+		query := c.Query("q")
+		c.HTML(http.StatusOK, "contexts.html", gin.H{
+			"Contexts":        filterContexts(contexts, query),
+			"Query":           query,
+			"SelectedContext": selected,
+			"OIDCEnabled":     s.oidc != nil,
+			"GitHubEnabled":   s.github != nil,
+			"CSRFToken":       token,
+		})
+	} else {
+		// Without contexts, offer the login methods that don't need one
+		c.HTML(http.StatusOK, "landing.html", gin.H{
+			"OIDCEnabled":       s.oidc != nil,
+			"GitHubEnabled":     s.github != nil,
+			"ClientCertEnabled": s.cfg.ClientCertAuth != "",
+		})
+	}
+}
+
+// handleSelectContext handles the context selection form.
+func (s *Server) handleSelectContext(c *gin.Context) {
+	if err := s.selectContext(c, c.PostForm("context")); err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, s.path("/home"))
+}
+
+// canSwitchContext reports whether the request's session was started by
+// selecting a kubeconfig context, rather than by OIDC or per-request
+// credentials, which have no context to switch from.
+func (s *Server) canSwitchContext(c *gin.Context) bool {
+	if _, ok := c.Get(requestAuthKey); ok {
+		return false
+	}
+	return s.inClusterConfig == nil && sessionIdentity(sessions.Default(c)).Context != ""
+}
+
+// handleSwitchContext handles the context switcher form of the home page.
+func (s *Server) handleSwitchContext(c *gin.Context) {
+	if err := s.switchContext(c, c.PostForm("context")); err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, s.path("/home"))
+}
+
+// handleLogout ends the session and forgets its cached authorization.
+func (s *Server) handleLogout(c *gin.Context) {
+	session := sessions.Default(c)
+	if s.authzCache != nil {
+		s.authzCache.invalidate(s.loginIdentity(session))
+	}
+
+	if err := clearSession(session, s.cfg.BasePath); err != nil {
+		requestLog(c.Request.Context()).Error("Failed to clear session", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+		return
+	}
+
+	c.Redirect(http.StatusFound, s.path("/"))
+}
+
+// handleHome is the protected home page.
+func (s *Server) handleHome(c *gin.Context) {
+	data, err := s.loadHome(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	// The logout form needs the session's CSRF token
+	session := sessions.Default(c)
+	token, tokenErr := csrfToken(session)
+	if tokenErr == nil {
+		tokenErr = session.Save()
+	}
+	if tokenErr != nil {
+		requestLog(c.Request.Context()).Error("Failed to create CSRF token", "error", tokenErr)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+		return
+	}
+
+	// The context switcher lists the other contexts of kubeconfig sessions
+	var contexts []contextInfo
+	selected := ""
+	if s.canSwitchContext(c) {
+		_, contexts = s.currentKubeConfig()
+		selected = sessionIdentity(session).Context
+	}
+
+	// Display the home page
+	c.HTML(http.StatusOK, "home.html", gin.H{
+		"CSRFToken":           token,
+		"Contexts":            contexts,
+		"SelectedContext":     selected,
+		"User":                data.User,
+		"ImpersonatedBy":      data.ImpersonatedBy,
+		"Cluster":             data.Cluster,
+		"GitVersion":          data.GitVersion,
+		"Platform":            data.Platform,
+		"AccessNamespace":     data.AccessNamespace,
+		"UserRoles":           data.UserRoles,
+		"ClusterRoleBindings": data.ClusterRoleBindings,
+		"RoleBindings":        roleBindingsByNamespace(data.RoleBindings),
+		"RoleBindingsHidden":  data.RoleBindingsHidden,
+	})
+}
+
+// handleMyAccess lists the bindings the user is a subject of.
+func (s *Server) handleMyAccess(c *gin.Context) {
+	data, err := s.loadMyAccess(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.HTML(http.StatusOK, "my-access.html", data)
+}
+
+// handleAPIContexts returns the selectable contexts matching the q query
+// parameter as JSON.
+func (s *Server) handleAPIContexts(c *gin.Context) {
+	_, contexts := s.currentKubeConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"contexts":  filterContexts(contexts, c.Query("q")),
+		"inCluster": s.inClusterConfig != nil,
+	})
+}
+
+// handleAPISelectContext selects a context given as {"context": "..."}.
+func (s *Server) handleAPISelectContext(c *gin.Context) {
+	contextName, ok := bindContextRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := s.selectContext(c, contextName); err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"context": contextName})
+}
+
+// handleAPISwitchContext moves the session to another context, taking a JSON
+// body of {"context": "..."}.
+func (s *Server) handleAPISwitchContext(c *gin.Context) {
+	contextName, ok := bindContextRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := s.switchContext(c, contextName); err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"context": contextName})
+}
+
+// bindContextRequest reads the context named by a JSON body of
+// {"context": "..."}, responding with an error when it can't.
+func bindContextRequest(c *gin.Context) (string, bool) {
+	if c.ContentType() != "application/json" {
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Content-Type must be application/json")
+		return "", false
+	}
+
+	var request struct {
+		Context string `json:"context"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Invalid request body")
+		return "", false
+	}
+	return request.Context, true
+}
+
+// handleAPIHome returns the home page bindings as JSON.
+func (s *Server) handleAPIHome(c *gin.Context) {
+	data, err := s.loadHome(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// handleWhoami returns who the request is authenticated as and whether they
+// are currently authorized to access the home page.
+func (s *Server) handleWhoami(c *gin.Context) {
+	id, clientset, err := s.requestClient(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	result, err := s.checkAccess(ctx, clientset, id)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":       id.User,
+		"groups":     id.Groups,
+		"context":    id.Context,
+		"cluster":    id.Cluster,
+		"authorized": result.Allowed,
+	})
+}
+
+// handleRefresh drops the cached authorization decision of the caller and
+// checks their access again, so access granted since the decision was cached
+// takes effect without logging out.
+func (s *Server) handleRefresh(c *gin.Context) {
+	id, clientset, err := s.requestClient(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	if s.authzCache != nil {
+		s.authzCache.invalidate(id)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	result, err := s.checkAccess(ctx, clientset, id)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"user":       id.User,
+		"context":    id.Context,
+		"authorized": result.Allowed,
+	}
+	if !result.Allowed {
+		response["reason"] = result.Reason
+		response["explanation"] = result.Explanation
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleAPIMyAccess returns the bindings the user is a subject of as JSON.
+func (s *Server) handleAPIMyAccess(c *gin.Context) {
+	data, err := s.loadMyAccess(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biodigitalJaz/web-kubeauth/internal/kubeconfigtest"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSelectUnknownContext(t *testing.T) {
+	s := newTestServer(t, testConfig(t, "viewer"), testClientsets(fake.NewSimpleClientset()))
+	client := newTestClient(t, s)
+
+	resp, body := client.postForm("/select-context", url.Values{"context": {"missing"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("selecting an unknown context returned %d, want %d:\n%s", resp.StatusCode, http.StatusBadRequest, body)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == defaultSessionCookieName {
+			t.Errorf("selecting an unknown context set the session cookie %s", cookie)
+		}
+	}
+
+	// The session of the CSRF token must not have been logged in either
+	resp, _ = client.get("/home", nil)
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/" {
+		t.Errorf("GET /home after an unknown context returned %d to %q, want a redirect to /", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestSelectContextKubeConfig(t *testing.T) {
+	cfg := testConfig(t, "viewer")
+	cfg.KubeConfigPath = writeKubeConfig(t,
+		[]kubeconfigtest.User{
+			{Name: "alice", Groups: []string{"developers"}},
+			{Name: "expired", CertExpiry: time.Now().Add(-time.Hour)},
+		},
+		[]kubeconfigtest.Context{
+			{Name: "dev", Cluster: "dev", User: "alice"},
+			{Name: "old", Cluster: "old", User: "expired"},
+		},
+	)
+	clientset := fake.NewSimpleClientset(clusterRoleBinding("developers-viewer", "viewer", groupSubject("developers")))
+	s := newTestServer(t, cfg, fakeClientsets{"": clientset, "dev": clientset, "old": clientset})
+	client := newTestClient(t, s)
+
+	_, body := client.get("/", nil)
+	for _, name := range []string{"dev", "old"} {
+		if !strings.Contains(body, `value="`+name+`"`) {
+			t.Errorf("the context selection page doesn't offer context %s:\n%s", name, body)
+		}
+	}
+
+	resp, body := client.postForm("/select-context", url.Values{"context": {"old"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("selecting the context of an expired certificate returned %d, want %d:\n%s", resp.StatusCode, http.StatusBadRequest, body)
+	}
+
+	client.login("dev")
+	if resp, body := client.get("/home", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /home after selecting context dev returned %d, want %d:\n%s", resp.StatusCode, http.StatusOK, body)
+	}
+}
+
+func TestHomeUnauthenticated(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		header   http.Header
+		wantCode int
+	}{
+		{name: "HTML page", path: "/home", wantCode: http.StatusFound},
+		{name: "HTML page asked for as JSON", path: "/home", header: http.Header{"Accept": {"application/json"}}, wantCode: http.StatusUnauthorized},
+		{name: "API", path: "/api/v1/home", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig(t, "viewer"), testClientsets(fake.NewSimpleClientset()))
+			client := newTestClient(t, s)
+
+			resp, body := client.get(tt.path, tt.header)
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("GET %s returned %d, want %d:\n%s", tt.path, resp.StatusCode, tt.wantCode, body)
+			}
+			switch tt.wantCode {
+			case http.StatusFound:
+				if location := resp.Header.Get("Location"); location != "/" {
+					t.Errorf("GET %s redirected to %q, want /", tt.path, location)
+				}
+			case http.StatusUnauthorized:
+				if resp.Header.Get("WWW-Authenticate") == "" {
+					t.Errorf("GET %s returned a 401 without a WWW-Authenticate header", tt.path)
+				}
+			}
+		})
+	}
+}
+
+func TestHomeAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindings []runtime.Object
+		wantCode int
+	}{
+		{
+			name:     "bound to the required role",
+			bindings: []runtime.Object{clusterRoleBinding("alice-viewer", "viewer", userSubject(testContextUser))},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "bound to another role",
+			bindings: []runtime.Object{clusterRoleBinding("alice-admin", "admin", userSubject(testContextUser))},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "not bound at all",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig(t, "viewer"), testClientsets(fake.NewSimpleClientset(tt.bindings...)))
+			client := newTestClient(t, s)
+			client.login(testContext)
+
+			for _, path := range []string{"/home", "/api/v1/home"} {
+				resp, body := client.get(path, nil)
+				if resp.StatusCode != tt.wantCode {
+					t.Errorf("GET %s returned %d, want %d:\n%s", path, resp.StatusCode, tt.wantCode, body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// handleHealthz is the liveness probe, the process is up and serving.
+func (s *Server) handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe, the kubeconfig must have loaded, the
+// default context's certificates must be valid, the Kubernetes API server
+// reachable and the ClusterRoleBinding cache synced. With
+// READINESS_ROLE_CHECK, the required roles must exist too.
+func (s *Server) handleReadyz(c *gin.Context) {
+	if err := s.kubeConfigError(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+	if err := s.contextError(s.defaultContext()); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+
+	restConfig, err := s.restConfig("")
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+
+	probeConfig := rest.CopyConfig(restConfig)
+	probeConfig.Timeout = s.cfg.ReadinessTimeout
+
+	clientset, err := kubernetes.NewForConfig(probeConfig)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+
+	// Ride out a briefly unavailable API server within the readiness timeout
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.ReadinessTimeout)
+	defer cancel()
+	if _, err := serverVersion(ctx, clientset, s.cfg.DiscoveryAttempts); err != nil {
+		requestLog(c.Request.Context()).Warn("Readiness check failed", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+
+	// Authorization reads ClusterRoleBindings from the informer
+	if s.cfg.AccessResource == "" && !s.crbInformers.synced(s.defaultContext()) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "ClusterRoleBinding cache not synced"})
+		return
+	}
+
+	// A missing required role denies everyone, optionally keep out of rotation
+	if s.cfg.ReadinessRoleCheck && s.cfg.AccessResource == "" {
+		if missing := s.missingRequiredRoles(c.Request.Context(), clientset); len(missing) > 0 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "required roles do not exist", "missingRoles": missing})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// impersonate returns the identity to act as user on behalf of admin, who
+// must be bound to one of the admin roles. The identity's checks are still
+// made with the admin's clientset, as SubjectAccessReviews of user and scans
+// of the bindings naming them, since user themself may not be allowed to
+// read the bindings or review access.
+func (s *Server) impersonate(ctx context.Context, admin identity, clientset kubernetes.Interface, user string) (identity, *httpError) {
+	logger := requestLog(ctx)
+
+	if len(s.adminRoles) == 0 {
+		return identity{}, &httpError{http.StatusForbidden, codeForbidden, "Impersonation is disabled."}
+	}
+	if err := validateInput("impersonated user", user); err != nil {
+		return identity{}, err
+	}
+
+	isAdmin, adminErr := s.isAdmin(ctx, clientset, admin)
+	if adminErr != nil {
+		return identity{}, adminErr
+	}
+
+	s.auditImpersonation(admin, user, isAdmin)
+	if !isAdmin {
+		logger.Warn("Impersonation denied", "user", admin.User, "impersonated_user", user)
+		return identity{}, &httpError{http.StatusForbidden, codeForbidden, "Only admins may impersonate other users."}
+	}
+
+	id := actingIdentity(admin, user)
+	id.ImpersonatedBy = admin.User
+
+	logger.Info("Impersonating user", "user", admin.User, "impersonated_user", user)
+	return id, nil
+}
+
+// isAdmin reports whether id is bound to one of the admin roles by a
+// ClusterRoleBinding.
+func (s *Server) isAdmin(ctx context.Context, clientset kubernetes.Interface, id identity) (bool, *httpError) {
+	isAdmin := false
+	err := s.eachClusterRoleBinding(ctx, clientset, id.Context, func(crb rbacv1.ClusterRoleBinding) bool {
+		isAdmin = s.grantsRequiredRole(crb.RoleRef, crb.Subjects, s.adminRoles, id)
+		return !isAdmin
+	})
+	if err != nil {
+		requestLog(ctx).Error("Failed to list ClusterRoleBindings", "context", id.Context, "error", err)
+		return false, kubeAPIError(err, "Failed to list ClusterRoleBindings")
+	}
+	return isAdmin, nil
+}
+
+// actingIdentity returns the identity of user as the admin acts as them in the
+// admin's context, with the implicit groups the API server gives an
+// impersonated user.
+func actingIdentity(admin identity, user string) identity {
+	id := identity{
+		User:    user,
+		Groups:  []string{"system:authenticated"},
+		Kind:    rbacv1.UserKind,
+		Context: admin.Context,
+		Cluster: admin.Cluster,
+	}
+	if namespace, _, ok := splitServiceAccountUsername(user); ok {
+		id.Kind = rbacv1.ServiceAccountKind
+		id.Groups = serviceAccountGroups(namespace)
+	}
+	return id
+}
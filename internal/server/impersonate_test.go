@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// impersonationClientset returns a fake cluster where testContextUser is an
+// admin and bob holds the viewer role and nothing else: no permission to
+// list bindings or create access reviews of his own. Only the admin's
+// clientset exists, so any check made as bob would fail.
+func impersonationClientset() *fake.Clientset {
+	return fake.NewSimpleClientset(
+		clusterRoleBinding("alice-admin", "kubeauth-admin", userSubject(testContextUser)),
+		clusterRoleBinding("bob-viewer", "viewer", userSubject("bob")),
+	)
+}
+
+func TestImpersonateRequiredRole(t *testing.T) {
+	cfg := testConfig(t, "viewer")
+	cfg.AdminRoles = []string{"kubeauth-admin"}
+	s := newTestServer(t, cfg, testClientsets(impersonationClientset()))
+	client := newTestClient(t, s)
+	client.login(testContext)
+
+	resp, body := client.get("/home?impersonate=bob", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /home impersonating bob returned %d, want %d:\n%s", resp.StatusCode, http.StatusOK, body)
+	}
+	if !strings.Contains(body, "bob-viewer") {
+		t.Errorf("the home page impersonating bob doesn't list his binding:\n%s", body)
+	}
+
+	resp, body = client.get("/home?impersonate=carol", nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /home impersonating carol returned %d, want %d:\n%s", resp.StatusCode, http.StatusForbidden, body)
+	}
+}
+
+func TestImpersonateAccessReview(t *testing.T) {
+	clientset := impersonationClientset()
+	var reviews []authorizationv1.SubjectAccessReviewSpec
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		reviews = append(reviews, review.Spec)
+		review.Status.Allowed = review.Spec.User == "bob"
+		return true, review, nil
+	})
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		t.Error("impersonation reviewed the admin's own access instead of the impersonated user's")
+		return true, nil, nil
+	})
+
+	cfg := testConfig(t)
+	cfg.AdminRoles = []string{"kubeauth-admin"}
+	cfg.AccessResource, cfg.AccessVerb = "pods", "list"
+	s := newTestServer(t, cfg, testClientsets(clientset))
+	client := newTestClient(t, s)
+	client.login(testContext)
+
+	resp, body := client.get("/api/v1/home?impersonate=bob", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/v1/home impersonating bob returned %d, want %d:\n%s", resp.StatusCode, http.StatusOK, body)
+	}
+	if len(reviews) != 1 {
+		t.Fatalf("impersonating bob created %d SubjectAccessReviews, want 1", len(reviews))
+	}
+	if reviews[0].User != "bob" || !slices.Contains(reviews[0].Groups, "system:authenticated") {
+		t.Errorf("SubjectAccessReview of %s %v, want bob in system:authenticated", reviews[0].User, reviews[0].Groups)
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// crbInformer keeps one context's ClusterRoleBindings in memory, synced by a
+// watch on the API server. failing is set once listing or watching fails, as
+// when the context's credentials can't be obtained.
+type crbInformer struct {
+	lister  rbaclisters.ClusterRoleBindingLister
+	synced  cache.InformerSynced
+	failing atomic.Bool
+	stop    chan struct{}
+}
+
+// crbInformerCache runs one ClusterRoleBinding informer per kubeconfig
+// context, started the first time the context is used.
+type crbInformerCache struct {
+	clientsets ClientsetFactory
+
+	mu        sync.Mutex
+	informers map[string]*crbInformer
+}
+
+// newCRBInformerCache returns informers built from the clientsets of
+// clientsets.
+func newCRBInformerCache(clientsets ClientsetFactory) *crbInformerCache {
+	return &crbInformerCache{
+		clientsets: clientsets,
+		informers:  make(map[string]*crbInformer),
+	}
+}
+
+// informer returns the running informer for contextName, starting it if
+// needed. The informer may not have synced yet.
+func (c *crbInformerCache) informer(contextName string) (*crbInformer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if informer, ok := c.informers[contextName]; ok {
+		return informer, nil
+	}
+
+	clientset, err := c.clientsets.Clientset(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	crbs := factory.Rbac().V1().ClusterRoleBindings()
+	informer := &crbInformer{
+		lister: crbs.Lister(),
+		synced: crbs.Informer().HasSynced,
+		stop:   make(chan struct{}),
+	}
+	err = crbs.Informer().SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		informer.failing.Store(true)
+		cache.DefaultWatchErrorHandler(r, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	factory.Start(informer.stop)
+
+	c.informers[contextName] = informer
+	return informer, nil
+}
+
+// synced reports whether the informer for contextName has started and
+// completed its initial list.
+func (c *crbInformerCache) synced(contextName string) bool {
+	c.mu.Lock()
+	informer, ok := c.informers[contextName]
+	c.mu.Unlock()
+	return ok && informer.synced()
+}
+
+// reset stops every informer so they are restarted from the current config on
+// next use.
+func (c *crbInformerCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, informer := range c.informers {
+		close(informer.stop)
+	}
+	c.informers = make(map[string]*crbInformer)
+}
+
+// list returns the cached ClusterRoleBindings of contextName, waiting for the
+// initial sync until ctx is done or the informer fails. It reports false when
+// the cache can't be used, so the caller can fall back to listing from the
+// API server and get its error.
+func (c *crbInformerCache) list(ctx context.Context, contextName string) ([]*rbacv1.ClusterRoleBinding, bool) {
+	informer, err := c.informer(contextName)
+	if err != nil {
+		requestLog(ctx).Warn("Failed to start ClusterRoleBinding informer", "context", contextName, "error", err)
+		return nil, false
+	}
+	cache.WaitForCacheSync(ctx.Done(), func() bool {
+		return informer.synced() || informer.failing.Load()
+	})
+	if !informer.synced() {
+		return nil, false
+	}
+
+	crbs, err := informer.lister.List(labels.Everything())
+	if err != nil {
+		return nil, false
+	}
+	return crbs, true
+}
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// contextInfo describes a kubeconfig context the user can select.
+type contextInfo struct {
+	Name    string `json:"name"`
+	Cluster string `json:"cluster"`
+	User    string `json:"user"`
+}
+
+// resolveKubeConfigPaths returns the kubeconfig files to load. It honors the
+// configured kubeconfig path, which like the KUBECONFIG environment variable
+// is a list separated by os.PathListSeparator, and falls back to the default
+// location for the current OS.
+func resolveKubeConfigPaths(kubeConfigPath string) []string {
+	if kubeConfigPath != "" {
+		var paths []string
+		for _, path := range strings.Split(kubeConfigPath, string(os.PathListSeparator)) {
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) > 0 {
+			return paths
+		}
+	}
+
+	// Determine the correct path for the kubeconfig file across different OS
+	if runtime.GOOS == "windows" {
+		return []string{filepath.Join(os.Getenv("USERPROFILE"), ".kube", "config")}
+	}
+	return []string{filepath.Join(os.Getenv("HOME"), ".kube", "config")}
+}
+
+// loadKubeConfig merges the given kubeconfig files and returns the result
+// serialized as YAML. Missing files are skipped; nil is returned when none of
+// the files provided any configuration.
+func loadKubeConfig(paths []string) ([]byte, error) {
+	loadingRules := &clientcmd.ClientConfigLoadingRules{Precedence: paths}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(rawConfig.Contexts) == 0 && len(rawConfig.Clusters) == 0 && len(rawConfig.AuthInfos) == 0 {
+		return nil, nil
+	}
+
+	return clientcmd.Write(rawConfig)
+}
+
+// loadKubeConfigDir merges every kubeconfig file in dir, in name order.
+// Hidden entries, such as the "..data" links of a mounted Secret, and files
+// that fail to load are skipped. Files often reuse cluster and user names
+// like "kubernetes-admin", so a cluster or user whose name an earlier file
+// already took is renamed after its file, keeping each context pointed at the
+// cluster and credentials of the file that defined it. Duplicate context names
+// keep the first file's context. nil is returned when no file provided any
+// configuration.
+func loadKubeConfigDir(dir string) (*clientcmdapi.Config, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := clientcmdapi.NewConfig()
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: path}
+		kubeConfig, err := loadingRules.Load()
+		if err != nil {
+			slog.Warn("Skipping invalid kubeconfig file", "path", path, "error", err)
+			continue
+		}
+		mergeKubeConfig(merged, kubeConfig, entry.Name())
+	}
+
+	if len(merged.Contexts) == 0 && len(merged.Clusters) == 0 && len(merged.AuthInfos) == 0 {
+		return nil, nil
+	}
+	return merged, nil
+}
+
+// mergeKubeConfig adds the contexts of kubeConfig, loaded from the file
+// named source, and the clusters and users they reference to merged.
+func mergeKubeConfig(merged, kubeConfig *clientcmdapi.Config, source string) {
+	clusterNames := make(map[string]string)
+	for name, cluster := range kubeConfig.Clusters {
+		clusterNames[name] = uniqueName(name, source, func(n string) bool { return merged.Clusters[n] != nil })
+		merged.Clusters[clusterNames[name]] = cluster
+	}
+	userNames := make(map[string]string)
+	for name, authInfo := range kubeConfig.AuthInfos {
+		userNames[name] = uniqueName(name, source, func(n string) bool { return merged.AuthInfos[n] != nil })
+		merged.AuthInfos[userNames[name]] = authInfo
+	}
+
+	for name, ctx := range kubeConfig.Contexts {
+		if _, ok := merged.Contexts[name]; ok {
+			slog.Warn("Duplicate kubeconfig context, keeping the first one", "context", name, "file", source)
+			continue
+		}
+		ctx.Cluster = valueOr(clusterNames[ctx.Cluster], ctx.Cluster)
+		ctx.AuthInfo = valueOr(userNames[ctx.AuthInfo], ctx.AuthInfo)
+		merged.Contexts[name] = ctx
+	}
+
+	if merged.CurrentContext == "" {
+		merged.CurrentContext = kubeConfig.CurrentContext
+	}
+}
+
+// uniqueName returns name, or name qualified by source when taken reports it
+// is already in use.
+func uniqueName(name, source string, taken func(string) bool) string {
+	if !taken(name) {
+		return name
+	}
+	return name + "@" + source
+}
+
+// valueOr returns value, or def when value is empty.
+func valueOr(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// serviceAccountUsername extracts the service account username (for example
+// "system:serviceaccount:default:kubeauth") from the subject claim of a
+// service account token. The token is the pod's own mounted credential, so its
+// signature is not verified here.
+func serviceAccountUsername(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("service account token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode service account token: %w", err)
+	}
+
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("failed to parse service account token claims: %w", err)
+	}
+	if claims.Subject == "" {
+		return "", errors.New("service account token has no subject")
+	}
+
+	return claims.Subject, nil
+}
+
+// authInfoToken returns the bearer token of a kubeconfig user, given inline
+// or in its token file, or "" when it has none.
+func authInfoToken(authInfo *clientcmdapi.AuthInfo) string {
+	if authInfo.Token != "" || authInfo.TokenFile == "" {
+		return authInfo.Token
+	}
+	token, err := os.ReadFile(authInfo.TokenFile)
+	if err != nil {
+		slog.Warn("Failed to read token file", "file", authInfo.TokenFile, "error", err)
+		return ""
+	}
+	return strings.TrimSpace(string(token))
+}
+
+// usesToken reports whether the named kubeconfig user authenticates with a
+// bearer token.
+func usesToken(kubeConfig *clientcmdapi.Config, userName string) bool {
+	authInfo, ok := kubeConfig.AuthInfos[userName]
+	return ok && authInfoToken(authInfo) != ""
+}
+
+// kubeConfigIdentity determines how the named kubeconfig user authenticates.
+// Users with a service account token are identified by the service account
+// username and the ServiceAccount subject kind; everyone else is a User
+// identified by the kubeconfig user name.
+func kubeConfigIdentity(kubeConfig *clientcmdapi.Config, userName string) (user, kind string) {
+	authInfo, ok := kubeConfig.AuthInfos[userName]
+	if !ok {
+		return userName, rbacv1.UserKind
+	}
+	token := authInfoToken(authInfo)
+	if token == "" {
+		return userName, rbacv1.UserKind
+	}
+
+	saUser, err := serviceAccountUsername(token)
+	if err != nil {
+		return userName, rbacv1.UserKind
+	}
+	if _, _, ok := splitServiceAccountUsername(saUser); !ok {
+		return userName, rbacv1.UserKind
+	}
+
+	return saUser, rbacv1.ServiceAccountKind
+}
+
+// userGroups returns the groups the named kubeconfig user belongs to: the
+// Organization fields of its client certificate, any impersonated groups, and
+// the system:authenticated group every authenticated user is part of.
+func userGroups(kubeConfig *clientcmdapi.Config, userName string) []string {
+	groups := []string{"system:authenticated"}
+
+	authInfo, ok := kubeConfig.AuthInfos[userName]
+	if !ok {
+		return groups
+	}
+
+	certPEM := authInfo.ClientCertificateData
+	var err error
+	if len(certPEM) == 0 && authInfo.ClientCertificate != "" {
+		certPEM, err = os.ReadFile(authInfo.ClientCertificate)
+	}
+	if err != nil {
+		slog.Warn("Failed to read client certificate", "user", userName, "error", err)
+	} else if block, _ := pem.Decode(certPEM); block != nil {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			slog.Warn("Failed to parse client certificate", "user", userName, "error", err)
+		} else {
+			groups = append(groups, cert.Subject.Organization...)
+		}
+	}
+
+	return append(groups, authInfo.ImpersonateGroups...)
+}
+
+// contextList returns the contexts of a kubeconfig sorted by name.
+func contextList(kubeConfig *clientcmdapi.Config) []contextInfo {
+	contexts := make([]contextInfo, 0, len(kubeConfig.Contexts))
+	for name, ctx := range kubeConfig.Contexts {
+		contexts = append(contexts, contextInfo{Name: name, Cluster: ctx.Cluster, User: ctx.AuthInfo})
+	}
+
+	sort.Slice(contexts, func(i, j int) bool {
+		return contexts[i].Name < contexts[j].Name
+	})
+	return contexts
+}
+
+// filterContexts returns the contexts whose name or cluster contains query,
+// ignoring case. An empty query matches every context.
+func filterContexts(contexts []contextInfo, query string) []contextInfo {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return contexts
+	}
+
+	matched := []contextInfo{}
+	for _, ctx := range contexts {
+		if strings.Contains(strings.ToLower(ctx.Name), query) || strings.Contains(strings.ToLower(ctx.Cluster), query) {
+			matched = append(matched, ctx)
+		}
+	}
+	return matched
+}
+
+// certExpiryWarning is how long before a certificate expires that validation
+// starts warning about it.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// validateKubeConfig parses the client and CA certificates of every context,
+// logging a warning for certificates that expire soon, and checks that their
+// exec credential plugins can run. It returns the contexts that can't be used
+// because a certificate is malformed or expired or a plugin can't run.
+func validateKubeConfig(kubeConfig *clientcmdapi.Config, now time.Time) map[string]error {
+	invalid := make(map[string]error)
+	for name, ctx := range kubeConfig.Contexts {
+		var certs []namedCert
+		if authInfo, ok := kubeConfig.AuthInfos[ctx.AuthInfo]; ok {
+			certs = append(certs, namedCert{"client certificate", authInfo.ClientCertificateData, authInfo.ClientCertificate})
+		}
+		if cluster, ok := kubeConfig.Clusters[ctx.Cluster]; ok {
+			certs = append(certs, namedCert{"certificate authority", cluster.CertificateAuthorityData, cluster.CertificateAuthority})
+		}
+
+		for _, cert := range certs {
+			if err := cert.validate(name, now); err != nil {
+				slog.Warn("Invalid kubeconfig certificate", "context", name, "error", err)
+				invalid[name] = err
+				break
+			}
+		}
+
+		if authInfo, ok := kubeConfig.AuthInfos[ctx.AuthInfo]; ok && invalid[name] == nil {
+			if err := validateExec(authInfo.Exec); err != nil {
+				slog.Warn("Unusable kubeconfig exec plugin", "context", name, "error", err)
+				invalid[name] = err
+			}
+		}
+	}
+	return invalid
+}
+
+// validateExec checks that an exec credential plugin, such as
+// aws-iam-authenticator or gke-gcloud-auth-plugin, can run in this process:
+// its command must be installed, and it must not need a terminal to prompt on,
+// as the server has none. client-go runs the plugin with the server's own
+// environment plus the plugin's configured env.
+func validateExec(execConfig *clientcmdapi.ExecConfig) error {
+	if execConfig == nil {
+		return nil
+	}
+	if _, err := exec.LookPath(execConfig.Command); err != nil {
+		return fmt.Errorf("exec credential plugin %q is not installed: %w", execConfig.Command, err)
+	}
+	if execConfig.InteractiveMode == clientcmdapi.AlwaysExecInteractiveMode {
+		return fmt.Errorf("exec credential plugin %q requires an interactive terminal", execConfig.Command)
+	}
+	return nil
+}
+
+// namedCert is a certificate referenced by a kubeconfig, given inline or as a
+// file.
+type namedCert struct {
+	kind string
+	data []byte
+	file string
+}
+
+// validate checks that the certificate parses and hasn't expired, warning
+// when it expires within certExpiryWarning.
+func (c namedCert) validate(contextName string, now time.Time) error {
+	data := c.data
+	if len(data) == 0 && c.file != "" {
+		var err error
+		if data, err = os.ReadFile(c.file); err != nil {
+			return fmt.Errorf("failed to read %s: %w", c.kind, err)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return fmt.Errorf("malformed %s: %w", c.kind, err)
+	}
+	for _, cert := range certs {
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("%s %q expired on %s", c.kind, cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+		}
+		if cert.NotAfter.Sub(now) < certExpiryWarning {
+			slog.Warn("Kubeconfig certificate expires soon",
+				"context", contextName,
+				"certificate", c.kind,
+				"subject", cert.Subject.CommonName,
+				"not_after", cert.NotAfter,
+			)
+		}
+	}
+	return nil
+}
+
+// parseCertificates parses every PEM certificate in data.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return certs, nil
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/biodigitalJaz/web-kubeauth/internal/kubeconfigtest"
+	rbacv1 "k8s.io/api/rbac/v1"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// testJWT returns an unsigned JWT with the claims in the JSON payload, as
+// far as serviceAccountUsername reads it.
+func testJWT(payload string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(payload)) + "." + encode([]byte("signature"))
+}
+
+func TestServiceAccountUsername(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "service account token", token: testJWT(`{"sub":"system:serviceaccount:ci:deployer","iss":"kubernetes/serviceaccount"}`), want: "system:serviceaccount:ci:deployer"},
+		{name: "other subject", token: testJWT(`{"sub":"alice"}`), want: "alice"},
+		{name: "static token", token: "0123456789abcdef", wantErr: true},
+		{name: "too many parts", token: testJWT(`{"sub":"alice"}`) + ".extra", wantErr: true},
+		{name: "payload not base64", token: "header.!!!.signature", wantErr: true},
+		{name: "payload not JSON", token: testJWT(`sub=alice`), wantErr: true},
+		{name: "no subject", token: testJWT(`{"iss":"kubernetes/serviceaccount"}`), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serviceAccountUsername(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serviceAccountUsername() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("serviceAccountUsername() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubeConfigIdentity(t *testing.T) {
+	saToken := testJWT(`{"sub":"system:serviceaccount:ci:deployer"}`)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(saToken+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	kubeConfig := clientcmdapi.NewConfig()
+	kubeConfig.AuthInfos["sa-inline"] = &clientcmdapi.AuthInfo{Token: saToken}
+	kubeConfig.AuthInfos["sa-file"] = &clientcmdapi.AuthInfo{TokenFile: tokenFile}
+	kubeConfig.AuthInfos["missing-file"] = &clientcmdapi.AuthInfo{TokenFile: filepath.Join(t.TempDir(), "missing")}
+	kubeConfig.AuthInfos["static-token"] = &clientcmdapi.AuthInfo{Token: "0123456789abcdef"}
+	kubeConfig.AuthInfos["other-subject"] = &clientcmdapi.AuthInfo{Token: testJWT(`{"sub":"alice"}`)}
+	kubeConfig.AuthInfos["cert"] = &clientcmdapi.AuthInfo{ClientCertificateData: []byte("certificate")}
+
+	tests := []struct {
+		userName string
+		wantUser string
+		wantKind string
+	}{
+		{userName: "sa-inline", wantUser: "system:serviceaccount:ci:deployer", wantKind: rbacv1.ServiceAccountKind},
+		{userName: "sa-file", wantUser: "system:serviceaccount:ci:deployer", wantKind: rbacv1.ServiceAccountKind},
+		{userName: "missing-file", wantUser: "missing-file", wantKind: rbacv1.UserKind},
+		{userName: "static-token", wantUser: "static-token", wantKind: rbacv1.UserKind},
+		{userName: "other-subject", wantUser: "other-subject", wantKind: rbacv1.UserKind},
+		{userName: "cert", wantUser: "cert", wantKind: rbacv1.UserKind},
+		{userName: "unknown", wantUser: "unknown", wantKind: rbacv1.UserKind},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.userName, func(t *testing.T) {
+			user, kind := kubeConfigIdentity(kubeConfig, tt.userName)
+			if user != tt.wantUser || kind != tt.wantKind {
+				t.Errorf("kubeConfigIdentity() = %q, %q, want %q, %q", user, kind, tt.wantUser, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestUserGroups(t *testing.T) {
+	kubeConfig, err := kubeconfigtest.Config(
+		[]kubeconfigtest.Cluster{{Name: "dev", Server: "https://dev.example.com"}},
+		[]kubeconfigtest.User{
+			{Name: "alice", Groups: []string{"developers", "ops"}},
+			{Name: "bob"},
+			{Name: "ci", Token: "0123456789abcdef"},
+		},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("failed to build kubeconfig: %v", err)
+	}
+	kubeConfig.AuthInfos["bob"].ImpersonateGroups = []string{"auditors"}
+
+	tests := []struct {
+		userName string
+		want     []string
+	}{
+		{userName: "alice", want: []string{"system:authenticated", "developers", "ops"}},
+		{userName: "bob", want: []string{"system:authenticated", "auditors"}},
+		{userName: "ci", want: []string{"system:authenticated"}},
+		{userName: "unknown", want: []string{"system:authenticated"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.userName, func(t *testing.T) {
+			// The certificate's organizations are a set, in no particular order
+			got := userGroups(kubeConfig, tt.userName)
+			slices.Sort(got)
+			slices.Sort(tt.want)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("userGroups() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateKubeConfig(t *testing.T) {
+	now := time.Now()
+	kubeConfig, err := kubeconfigtest.Config(
+		[]kubeconfigtest.Cluster{{Name: "dev", Server: "https://dev.example.com"}},
+		[]kubeconfigtest.User{
+			{Name: "alice"},
+			{Name: "expired", CertExpiry: now.Add(-time.Hour)},
+			{Name: "ci", Token: "0123456789abcdef"},
+		},
+		[]kubeconfigtest.Context{
+			{Name: "alice", Cluster: "dev", User: "alice"},
+			{Name: "expired", Cluster: "dev", User: "expired"},
+			{Name: "ci", Cluster: "dev", User: "ci"},
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to build kubeconfig: %v", err)
+	}
+
+	invalid := validateKubeConfig(kubeConfig, now)
+	if len(invalid) != 1 || invalid["expired"] == nil {
+		t.Errorf("validateKubeConfig() = %v, want only the expired context", invalid)
+	}
+}
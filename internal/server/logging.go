@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader carries the correlation ID of a request, both from a proxy
+// in front of the server and back to the client.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the length of request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// loggerKey is the request context key of the request's logger.
+type loggerKey struct{}
+
+// requestID reads the request's X-Request-ID, generating one when it is
+// missing, echoes it in the response and attaches a logger carrying it to the
+// request context.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Header(requestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), loggerKey{}, logger))
+		c.Next()
+	}
+}
+
+// newRequestID returns a random 16 byte hex-encoded ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand only fails if the OS has no entropy source
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestLog returns the logger of the request ctx belongs to, or the default
+// logger outside of a request.
+func requestLog(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestLogger logs one structured entry per handled request.
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency", time.Since(start),
+			"client_ip", c.ClientIP(),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		requestLog(c.Request.Context()).Log(c.Request.Context(), level, "Request handled", attrs...)
+	}
+}
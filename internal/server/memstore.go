@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/base32"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+)
+
+// memorySessionPruneInterval is how often expired sessions are dropped from
+// a memoryStore.
+const memorySessionPruneInterval = time.Minute
+
+// memorySession is the data of one session kept by a memoryStore.
+type memorySession struct {
+	values  map[any]any
+	expires time.Time
+}
+
+// memoryStore keeps session data in process memory and only a signed session
+// ID in the cookie, so the cookie stays small however much the session holds.
+// Sessions are lost on restart and aren't shared between replicas; use the
+// Redis backend for that. A session expires MaxAge after it was last saved.
+type memoryStore struct {
+	codecs  []securecookie.Codec
+	options *gsessions.Options
+
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastPrune time.Time
+}
+
+// newMemoryStore returns an empty memoryStore signing session IDs with
+// keyPairs, as for the cookie store.
+func newMemoryStore(keyPairs ...[]byte) *memoryStore {
+	return &memoryStore{
+		codecs:   securecookie.CodecsFromPairs(keyPairs...),
+		options:  &gsessions.Options{Path: "/", MaxAge: int(defaultSessionMaxAge.Seconds())},
+		sessions: make(map[string]memorySession),
+	}
+}
+
+// Options sets the options of the session cookie.
+func (m *memoryStore) Options(options sessions.Options) {
+	m.options = options.ToGorillaOptions()
+}
+
+// Get returns the named session of r, loaded once per request.
+func (m *memoryStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(m, name)
+}
+
+// New returns the session whose ID is in r's cookie, or a new session when
+// there is no cookie or its session has expired.
+func (m *memoryStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(m, name)
+	options := *m.options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, cookie.Value, &session.ID, m.codecs...); err != nil {
+		return session, err
+	}
+
+	values, ok := m.load(session.ID, time.Now())
+	if !ok {
+		session.ID = ""
+		return session, nil
+	}
+	session.Values = values
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session's data and sets the cookie holding its ID. A
+// negative MaxAge deletes the session.
+func (m *memoryStore) Save(_ *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		m.delete(session.ID)
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	ttl := time.Duration(session.Options.MaxAge) * time.Second
+	if ttl == 0 {
+		ttl = defaultSessionMaxAge
+	}
+	session.ID = m.store(session.ID, session.Values, time.Now().Add(ttl))
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, m.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// load returns a copy of the data of the session id, unless it has expired.
+func (m *memoryStore) load(id string, now time.Time) (map[any]any, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || now.After(session.expires) {
+		return nil, false
+	}
+	// Concurrent requests of a session must not share its map
+	return maps.Clone(session.values), true
+}
+
+// store saves a copy of values as the data of the session id, dropping
+// expired sessions along the way, and returns the ID they were saved under.
+// Sessions without an ID get a new one, and so do those logging in or
+// switching users: the ID of the session before is dropped, so an ID planted
+// in a browser before the login is never authenticated.
+func (m *memoryStore) store(id string, values map[any]any, expires time.Time) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastPrune) > memorySessionPruneInterval {
+		for key, session := range m.sessions {
+			if now.After(session.expires) {
+				delete(m.sessions, key)
+			}
+		}
+		m.lastPrune = now
+	}
+
+	if id != "" && loggedIn(m.sessions[id].values, values) {
+		delete(m.sessions, id)
+		id = ""
+	}
+	if id == "" {
+		id = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	m.sessions[id] = memorySession{values: maps.Clone(values), expires: expires}
+	return id
+}
+
+// loggedIn reports whether the session data values is authenticated as
+// another user or context than before, its previous data.
+func loggedIn(before, values map[any]any) bool {
+	if values["authenticated"] != true {
+		return false
+	}
+	return before["authenticated"] != true || before["user"] != values["user"] || before["context"] != values["context"]
+}
+
+// delete forgets the session id.
+func (m *memoryStore) delete(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeauth_http_requests_total",
+		Help: "Number of HTTP requests handled, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kubeauth_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	authzDecisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeauth_authz_decisions_total",
+		Help: "Number of authorization decisions made, by decision.",
+	}, []string{"decision"})
+
+	authzCacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeauth_authz_cache_requests_total",
+		Help: "Number of authorization cache lookups, by result.",
+	}, []string{"result"})
+
+	kubeAPIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kubeauth_kube_api_request_duration_seconds",
+		Help:    "Latency of calls to the Kubernetes API, by call.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"call"})
+
+	panicsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubeauth_panics_total",
+		Help: "Number of handler panics recovered.",
+	})
+)
+
+// metricsMiddleware records the count and latency of every request. Requests
+// are labelled by their route template to keep label cardinality bounded.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// authzDecision names an authorization outcome, "allow" or "deny".
+func authzDecision(allowed bool) string {
+	if allowed {
+		return "allow"
+	}
+	return "deny"
+}
+
+// recordAuthzDecision counts an allow or deny decision.
+func recordAuthzDecision(allowed bool) {
+	authzDecisionsTotal.WithLabelValues(authzDecision(allowed)).Inc()
+}
+
+// recordAuthzCacheLookup counts an authorization cache hit or miss.
+func recordAuthzCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	authzCacheRequestsTotal.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// States of a cluster on the multi-cluster home page.
+const (
+	clusterAuthorized = "authorized"
+	clusterDenied     = "denied"
+	clusterFailed     = "error"
+)
+
+// clusterAccess is whether the user is authorized in the cluster of one
+// kubeconfig context, and the roles they are bound to there. When the
+// cluster couldn't be checked, State is clusterFailed and Error says why.
+type clusterAccess struct {
+	Context         string        `json:"context"`
+	Cluster         string        `json:"cluster"`
+	State           string        `json:"state"`
+	User            string        `json:"user,omitempty"`
+	Authorized      bool          `json:"authorized"`
+	AccessNamespace string        `json:"accessNamespace,omitempty"`
+	UserRoles       []string      `json:"userRoles"`
+	Error           *clusterError `json:"error,omitempty"`
+}
+
+// clusterError is why one cluster couldn't be checked, in the form of the
+// API's error responses.
+type clusterError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// clustersData is the aggregated home page of MULTI_CLUSTER mode.
+type clustersData struct {
+	User     string          `json:"user"`
+	Clusters []clusterAccess `json:"clusters"`
+}
+
+// clusterIdentity returns who the user of base is in the named context. A
+// session logged in with a kubeconfig context is the user of each context in
+// turn, while users who logged in another way, such as with OIDC, are the
+// same user everywhere.
+func (s *Server) clusterIdentity(ctx context.Context, base identity, contextName string) (identity, *httpError) {
+	if base.Context != "" {
+		return s.contextIdentity(ctx, contextName)
+	}
+
+	kubeConfig, _ := s.currentKubeConfig()
+	id := base
+	id.Context = contextName
+	if kubeContext, ok := kubeConfig.Contexts[contextName]; ok {
+		id.Cluster = kubeContext.Cluster
+	}
+	return id, nil
+}
+
+// loadClusterAccess authorizes the user of base in the named context and
+// collects their roles there, within CLUSTER_TIMEOUT.
+func (s *Server) loadClusterAccess(ctx context.Context, base identity, contextName string) (clusterAccess, *httpError) {
+	logger := requestLog(ctx)
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.ClusterTimeout)
+	defer cancel()
+
+	id, idErr := s.clusterIdentity(ctx, base, contextName)
+	if idErr != nil {
+		return clusterAccess{}, idErr
+	}
+
+	clientset, err := s.clientsets.Clientset(contextName)
+	if err != nil {
+		logger.Error("Failed to create Kubernetes clientset", "context", contextName, "error", err)
+		return clusterAccess{}, &httpError{http.StatusInternalServerError, codeInternal, "Failed to create Kubernetes clientset"}
+	}
+
+	// A cluster that can't be reached would fail every call, say so once
+	if _, err := serverVersion(ctx, clientset, 1); err != nil && !isAPIStatus(err) {
+		logger.Warn("Kubernetes API unreachable", "context", contextName, "error", err)
+		return clusterAccess{}, &httpError{http.StatusBadGateway, codeKubeUnreachable, fmt.Sprintf("The Kubernetes API of cluster %s is unreachable", id.Cluster)}
+	}
+
+	result, authzErr := s.checkAccess(ctx, clientset, id)
+	if authzErr != nil {
+		return clusterAccess{}, authzErr
+	}
+
+	crbs, err := s.userClusterRoleBindings(ctx, clientset, id, false)
+	if err != nil {
+		logger.Error("Failed to list ClusterRoleBindings", "context", contextName, "error", err)
+		return clusterAccess{}, kubeAPIError(err, "Failed to list ClusterRoleBindings")
+	}
+
+	// Without access to the RoleBindings only the cluster-wide roles are shown
+	rbs, err := s.userRoleBindings(ctx, clientset, s.cfg.TargetNamespace, id, false)
+	if apierrors.IsForbidden(err) {
+		logger.Warn("Not allowed to list RoleBindings", "context", contextName, "namespace", s.cfg.TargetNamespace, "error", err)
+	} else if err != nil {
+		logger.Error("Failed to list RoleBindings", "context", contextName, "error", err)
+		return clusterAccess{}, kubeAPIError(err, "Failed to list RoleBindings")
+	}
+
+	state := clusterDenied
+	if result.Allowed {
+		state = clusterAuthorized
+	}
+	return clusterAccess{
+		Context:         contextName,
+		Cluster:         id.Cluster,
+		State:           state,
+		User:            id.User,
+		Authorized:      result.Allowed,
+		AccessNamespace: result.Namespace,
+		UserRoles:       s.userRoles(crbs, rbs, id),
+	}, nil
+}
+
+// isAPIStatus reports whether err is a response of the API server, as opposed
+// to a failure to reach it.
+func isAPIStatus(err error) bool {
+	var status apierrors.APIStatus
+	return errors.As(err, &status)
+}
+
+// loadClusters checks the session's user in every kubeconfig context, a few
+// contexts at a time, so a kubeconfig of many clusters doesn't take a round
+// trip per cluster in turn. A cluster that fails is reported in its own entry
+// rather than failing the page.
+func (s *Server) loadClusters(c *gin.Context) (*clustersData, *httpError) {
+	if _, ok := c.Get(requestAuthKey); ok {
+		return nil, &httpError{http.StatusBadRequest, codeBadRequest, "Bearer tokens and client certificates are only valid for one cluster, log in to see every cluster."}
+	}
+	if s.inClusterConfig != nil {
+		return nil, &httpError{http.StatusBadRequest, codeBadRequest, "There is only one cluster in-cluster."}
+	}
+
+	session := sessions.Default(c)
+	if !isAuthenticated(session) {
+		return nil, &httpError{http.StatusUnauthorized, codeUnauthenticated, "Not authenticated"}
+	}
+	base := s.loginIdentity(session)
+
+	_, contexts := s.currentKubeConfig()
+	clusters := make([]clusterAccess, len(contexts))
+	sem := make(chan struct{}, s.cfg.ClusterConcurrency)
+	var wg sync.WaitGroup
+	for i, kubeContext := range contexts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			access, err := s.loadClusterAccess(c.Request.Context(), base, kubeContext.Name)
+			if err != nil {
+				access = clusterAccess{
+					Context:   kubeContext.Name,
+					Cluster:   kubeContext.Cluster,
+					State:     clusterFailed,
+					UserRoles: []string{},
+					Error:     &clusterError{Code: err.Code, Message: err.Message},
+				}
+			}
+			clusters[i] = access
+		}()
+	}
+	wg.Wait()
+
+	return &clustersData{User: base.User, Clusters: clusters}, nil
+}
+
+// handleClusters is the home page in MULTI_CLUSTER mode, listing the user's
+// access in every cluster of the kubeconfig.
+func (s *Server) handleClusters(c *gin.Context) {
+	data, err := s.loadClusters(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	// The logout form needs the session's CSRF token
+	session := sessions.Default(c)
+	token, tokenErr := csrfToken(session)
+	if tokenErr == nil {
+		tokenErr = session.Save()
+	}
+	if tokenErr != nil {
+		requestLog(c.Request.Context()).Error("Failed to create CSRF token", "error", tokenErr)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+		return
+	}
+
+	c.HTML(http.StatusOK, "clusters.html", gin.H{
+		"CSRFToken": token,
+		"User":      data.User,
+		"Clusters":  data.Clusters,
+	})
+}
+
+// handleAPIClusters is the JSON form of the MULTI_CLUSTER home page.
+func (s *Server) handleAPIClusters(c *gin.Context) {
+	data, err := s.loadClusters(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// A namespace is accessible to a user who may list its pods, the least a
+// user working in a namespace needs.
+const (
+	namespaceAccessVerb     = "list"
+	namespaceAccessResource = "pods"
+)
+
+// namespaceReviewConcurrency bounds the access reviews made at once when
+// checking every namespace.
+const namespaceReviewConcurrency = 8
+
+// maxListedNamespaces is the most namespaces /namespaces lists and reviews, so
+// a cluster with thousands of them can't need thousands of reviews within one
+// API_TIMEOUT.
+const maxListedNamespaces = 250
+
+// namespaceSessionKey is the session key of the selected namespace.
+const namespaceSessionKey = "namespace"
+
+// namespaceAccess is a namespace and whether the user can work in it.
+type namespaceAccess struct {
+	Name       string `json:"name"`
+	Accessible bool   `json:"accessible"`
+}
+
+// namespacesData is the namespace list of /namespaces.
+type namespacesData struct {
+	User       string            `json:"user"`
+	Selected   string            `json:"selected,omitempty"`
+	Namespaces []namespaceAccess `json:"namespaces"`
+	// Truncated is set when the cluster has more than the namespaces listed.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// canUseNamespace asks the API server whether id may list the pods of
+// namespace.
+func canUseNamespace(ctx context.Context, clientset kubernetes.Interface, id identity, namespace string) (bool, error) {
+	return reviewAccess(ctx, clientset, id, &authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      namespaceAccessVerb,
+		Resource:  namespaceAccessResource,
+	})
+}
+
+// namespaceAccessList lists the cluster's namespaces, up to
+// maxListedNamespaces of them, marking those id can use and reporting whether
+// there were more. The reviews run a few at a time so a cluster with many
+// namespaces doesn't take a round trip per namespace in turn.
+func namespaceAccessList(ctx context.Context, clientset kubernetes.Interface, id identity) ([]namespaceAccess, bool, error) {
+	list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{Limit: maxListedNamespaces})
+	if err != nil {
+		return nil, false, err
+	}
+	// Servers may ignore the limit, and the fake clientset does
+	items := list.Items
+	truncated := list.Continue != ""
+	if len(items) > maxListedNamespaces {
+		items, truncated = items[:maxListedNamespaces], true
+	}
+
+	namespaces := make([]namespaceAccess, len(items))
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, namespaceReviewConcurrency)
+	var wg sync.WaitGroup
+	for i, ns := range items {
+		namespaces[i].Name = ns.Name
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			namespaces[i].Accessible, errs[i] = canUseNamespace(ctx, clientset, id, ns.Name)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return namespaces, truncated, nil
+}
+
+// roleBindingNamespace returns the namespace RoleBindings are listed in for
+// display: TARGET_NAMESPACE when set, since it bounds what the app may see,
+// otherwise the namespace selected in the session, if any.
+func (s *Server) roleBindingNamespace(c *gin.Context) string {
+	if s.cfg.TargetNamespace != "" {
+		return s.cfg.TargetNamespace
+	}
+	if _, ok := c.Get(requestAuthKey); ok {
+		return ""
+	}
+	namespace, _ := sessions.Default(c).Get(namespaceSessionKey).(string)
+	return namespace
+}
+
+// loadNamespaces loads the namespace list of the request's user.
+func (s *Server) loadNamespaces(c *gin.Context) (*namespacesData, *httpError) {
+	id, clientset, clientErr := s.requestClient(c)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	defer cancel()
+
+	namespaces, truncated, err := namespaceAccessList(ctx, clientset, id)
+	if err != nil {
+		requestLog(ctx).Error("Failed to list namespaces", "context", id.Context, "error", err)
+		return nil, kubeAPIError(err, "Failed to list namespaces")
+	}
+
+	return &namespacesData{
+		User:       id.User,
+		Selected:   s.roleBindingNamespace(c),
+		Namespaces: namespaces,
+		Truncated:  truncated,
+	}, nil
+}
+
+// selectNamespace stores namespace in the session to scope the RoleBindings
+// shown, once the API server confirms the user can use it. An empty namespace
+// goes back to all namespaces.
+func (s *Server) selectNamespace(c *gin.Context, namespace string) *httpError {
+	if _, ok := c.Get(requestAuthKey); ok {
+		return &httpError{http.StatusBadRequest, codeBadRequest, "Only logged in sessions can select a namespace."}
+	}
+	if s.cfg.TargetNamespace != "" {
+		return &httpError{http.StatusBadRequest, codeBadRequest, fmt.Sprintf("RoleBindings are always listed in namespace %s.", s.cfg.TargetNamespace)}
+	}
+	if err := validateInput("namespace", namespace); err != nil {
+		return err
+	}
+
+	id, clientset, clientErr := s.requestClient(c)
+	if clientErr != nil {
+		return clientErr
+	}
+
+	session := sessions.Default(c)
+	if namespace == "" {
+		session.Delete(namespaceSessionKey)
+	} else {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+		defer cancel()
+
+		allowed, err := canUseNamespace(ctx, clientset, id, namespace)
+		if err != nil {
+			requestLog(ctx).Error("Failed to review namespace access", "context", id.Context, "namespace", namespace, "error", err)
+			return kubeAPIError(err, "Failed to review access")
+		}
+		if !allowed {
+			return &httpError{http.StatusForbidden, codeForbidden, fmt.Sprintf("You need permission to %s %s in namespace %s to select it.", namespaceAccessVerb, namespaceAccessResource, namespace)}
+		}
+		session.Set(namespaceSessionKey, namespace)
+	}
+
+	if err := session.Save(); err != nil {
+		requestLog(c.Request.Context()).Error("Failed to save session", "error", err)
+		return &httpError{http.StatusInternalServerError, codeInternal, "Failed to save session"}
+	}
+	return nil
+}
+
+// handleNamespaces lists the namespaces and which of them the user can use.
+func (s *Server) handleNamespaces(c *gin.Context) {
+	data, err := s.loadNamespaces(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	// The selection form needs the session's CSRF token
+	session := sessions.Default(c)
+	token, tokenErr := csrfToken(session)
+	if tokenErr == nil {
+		tokenErr = session.Save()
+	}
+	if tokenErr != nil {
+		requestLog(c.Request.Context()).Error("Failed to create CSRF token", "error", tokenErr)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+		return
+	}
+
+	c.HTML(http.StatusOK, "namespaces.html", gin.H{
+		"CSRFToken":  token,
+		"User":       data.User,
+		"Selected":   data.Selected,
+		"Namespaces": data.Namespaces,
+		"Truncated":  data.Truncated,
+		"Fixed":      s.cfg.TargetNamespace != "",
+	})
+}
+
+// handleSelectNamespace handles the namespace selection form.
+func (s *Server) handleSelectNamespace(c *gin.Context) {
+	if err := s.selectNamespace(c, c.PostForm("namespace")); err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, s.path("/home"))
+}
+
+// handleAPINamespaces is the JSON form of /namespaces.
+func (s *Server) handleAPINamespaces(c *gin.Context) {
+	data, err := s.loadNamespaces(c)
+	if err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// handleAPISelectNamespace selects a namespace given as {"namespace": "..."}.
+func (s *Server) handleAPISelectNamespace(c *gin.Context) {
+	if c.ContentType() != "application/json" {
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Content-Type must be application/json")
+		return
+	}
+
+	var request struct {
+		Namespace string `json:"namespace"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := s.selectNamespace(c, request.Namespace); err != nil {
+		respondHTTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"namespace": request.Namespace})
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// namespaceClientset returns a fake cluster with the given namespaces where a
+// user logged in with their own credentials may list pods in team-a only.
+// Such users can't create SubjectAccessReviews, so those fail the test.
+func namespaceClientset(t *testing.T, names ...string) *fake.Clientset {
+	t.Helper()
+
+	objects := []runtime.Object{clusterRoleBinding("alice-viewer", "viewer", userSubject(testContextUser))}
+	for _, name := range names {
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	clientset := fake.NewSimpleClientset(objects...)
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = attributes.Namespace == "team-a" && attributes.Verb == namespaceAccessVerb && attributes.Resource == namespaceAccessResource
+		return true, review, nil
+	})
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		t.Error("a user with their own credentials was reviewed with a SubjectAccessReview")
+		return true, nil, fmt.Errorf("forbidden")
+	})
+	return clientset
+}
+
+func TestNamespacesOwnCredentials(t *testing.T) {
+	s := newTestServer(t, testConfig(t, "viewer"), testClientsets(namespaceClientset(t, "team-a", "team-b")))
+	client := newTestClient(t, s)
+	client.login(testContext)
+
+	resp, body := client.get("/api/v1/namespaces", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/v1/namespaces returned %d, want %d:\n%s", resp.StatusCode, http.StatusOK, body)
+	}
+	var data namespacesData
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatalf("failed to decode namespaces: %v", err)
+	}
+	want := []namespaceAccess{{Name: "team-a", Accessible: true}, {Name: "team-b"}}
+	if fmt.Sprint(data.Namespaces) != fmt.Sprint(want) {
+		t.Errorf("namespaces are %v, want %v", data.Namespaces, want)
+	}
+	if data.Truncated {
+		t.Error("two namespaces were reported as truncated")
+	}
+
+	tests := []struct {
+		namespace string
+		wantCode  int
+	}{
+		{namespace: "team-a", wantCode: http.StatusFound},
+		{namespace: "team-b", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			resp, body := client.postForm("/select-namespace", url.Values{"namespace": {tt.namespace}})
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("selecting %s returned %d, want %d:\n%s", tt.namespace, resp.StatusCode, tt.wantCode, body)
+			}
+		})
+	}
+}
+
+func TestNamespacesTruncated(t *testing.T) {
+	names := make([]string, maxListedNamespaces+1)
+	for i := range names {
+		names[i] = fmt.Sprintf("ns-%03d", i)
+	}
+	s := newTestServer(t, testConfig(t, "viewer"), testClientsets(namespaceClientset(t, names...)))
+	client := newTestClient(t, s)
+	client.login(testContext)
+
+	resp, body := client.get("/api/v1/namespaces", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/v1/namespaces returned %d, want %d:\n%s", resp.StatusCode, http.StatusOK, body)
+	}
+	var data namespacesData
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatalf("failed to decode namespaces: %v", err)
+	}
+	if len(data.Namespaces) != maxListedNamespaces || !data.Truncated {
+		t.Errorf("listed %d namespaces, truncated %t, want %d, truncated", len(data.Namespaces), data.Truncated, maxListedNamespaces)
+	}
+
+	resp, body = client.get("/namespaces", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /namespaces returned %d, want %d:\n%s", resp.StatusCode, http.StatusOK, body)
+	}
+	if want := fmt.Sprintf("Only the first %d namespaces are listed.", maxListedNamespaces); !strings.Contains(body, want) {
+		t.Errorf("the namespaces page doesn't say %q:\n%s", want, body)
+	}
+}
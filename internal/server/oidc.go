@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// oidcProvider implements the OIDC authorization code flow as an alternative
+// to selecting a kubeconfig context.
+type oidcProvider struct {
+	verifier       *oidc.IDTokenVerifier
+	oauth2Config   oauth2.Config
+	usernameClaim  string
+	groupsClaim    string
+	usernamePrefix string
+	groupsPrefix   string
+
+	// homePath is where users land once logged in
+	homePath string
+}
+
+// newOIDCProvider discovers the configured OIDC provider, for the app served
+// at basePath. It returns nil when OIDC is not configured.
+func newOIDCProvider(ctx context.Context, cfg OIDCConfig, basePath string) (*oidcProvider, error) {
+	if cfg.IssuerURL == "" {
+		return nil, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+
+	return &oidcProvider{
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		oauth2Config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile", "groups"},
+		},
+		usernameClaim:  cfg.UsernameClaim,
+		groupsClaim:    cfg.GroupsClaim,
+		usernamePrefix: cfg.UsernamePrefix,
+		groupsPrefix:   cfg.GroupsPrefix,
+		homePath:       basePath + "/home",
+	}, nil
+}
+
+// randomString returns a URL-safe random string for OAuth2 state and nonce values.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// handleLogin starts the authorization code flow.
+func (p *oidcProvider) handleLogin(c *gin.Context) {
+	logger := requestLog(c.Request.Context())
+	state, err := randomString()
+	if err != nil {
+		logger.Error("Failed to generate OIDC state", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to start login")
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		logger.Error("Failed to generate OIDC nonce", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to start login")
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("oidc_state", state)
+	session.Set("oidc_nonce", nonce)
+	if err := session.Save(); err != nil {
+		logger.Error("Failed to save session", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+		return
+	}
+
+	c.Redirect(http.StatusFound, p.oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce)))
+}
+
+// handleCallback exchanges the authorization code, validates the ID token and
+// stores the user's identity and groups in the session.
+func (p *oidcProvider) handleCallback(c *gin.Context) {
+	logger := requestLog(c.Request.Context())
+	session := sessions.Default(c)
+	state, _ := session.Get("oidc_state").(string)
+	nonce, _ := session.Get("oidc_nonce").(string)
+	session.Delete("oidc_state")
+	session.Delete("oidc_nonce")
+
+	if state == "" || c.Query("state") != state {
+		respondError(c, http.StatusBadRequest, codeInvalidLoginState, "Invalid login state")
+		return
+	}
+	if errParam := c.Query("error"); errParam != "" {
+		logger.Warn("OIDC login failed", "error", errParam, "description", c.Query("error_description"))
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed")
+		return
+	}
+
+	token, err := p.oauth2Config.Exchange(c.Request.Context(), c.Query("code"))
+	if err != nil {
+		logger.Error("Failed to exchange OIDC code", "error", err)
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed")
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed: no ID token returned")
+		return
+	}
+
+	idToken, err := p.verifier.Verify(c.Request.Context(), rawIDToken)
+	if err != nil {
+		logger.Warn("Failed to verify OIDC ID token", "error", err)
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed: invalid ID token")
+		return
+	}
+	if idToken.Nonce != nonce {
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed: invalid nonce")
+		return
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		logger.Error("Failed to parse OIDC claims", "error", err)
+		respondError(c, http.StatusUnauthorized, codeLoginFailed, "Login failed")
+		return
+	}
+
+	id, claimsErr := p.claimsIdentity(claims)
+	if claimsErr != nil {
+		logger.Warn("Rejected OIDC ID token claims", "error", claimsErr.Message)
+		respondHTTPError(c, claimsErr)
+		return
+	}
+
+	// The cluster is queried with the application's own credentials
+	if err := saveIdentity(session, id); err != nil {
+		logger.Error("Failed to save session", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to save session")
+		return
+	}
+
+	logger.Info("OIDC login succeeded", "user", id.User)
+	c.Redirect(http.StatusFound, p.homePath)
+}
+
+// claimsIdentity returns the identity named by the claims of a verified ID
+// token, with the configured prefixes. As in the API server, an email is only
+// trusted as the username once the provider has verified it, since anyone
+// could otherwise sign up with the email of a cluster user.
+func (p *oidcProvider) claimsIdentity(claims map[string]any) (identity, *httpError) {
+	user, _ := claims[p.usernameClaim].(string)
+	if user == "" {
+		return identity{}, &httpError{http.StatusUnauthorized, codeLoginFailed, fmt.Sprintf("Login failed: ID token has no %q claim", p.usernameClaim)}
+	}
+	if p.usernameClaim == "email" {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return identity{}, &httpError{http.StatusUnauthorized, codeLoginFailed, "Login failed: the ID token's email is not verified"}
+		}
+	}
+
+	groups := []string{"system:authenticated"}
+	if values, ok := claims[p.groupsClaim].([]any); ok {
+		for _, value := range values {
+			if group, ok := value.(string); ok {
+				groups = append(groups, p.groupsPrefix+group)
+			}
+		}
+	}
+
+	id := identity{User: p.usernamePrefix + user, Groups: groups, Kind: rbacv1.UserKind}
+	if err := validateInput("user", id.User); err != nil {
+		return identity{}, err
+	}
+	if err := validateInput("group", id.Groups...); err != nil {
+		return identity{}, err
+	}
+	return id, nil
+}
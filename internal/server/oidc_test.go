@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOIDCClaimsIdentity(t *testing.T) {
+	emailProvider := &oidcProvider{usernameClaim: "email", groupsClaim: "groups"}
+	subProvider := &oidcProvider{usernameClaim: "sub", groupsClaim: "groups"}
+	prefixedProvider := &oidcProvider{usernameClaim: "email", groupsClaim: "groups", usernamePrefix: "oidc:", groupsPrefix: "oidc:"}
+
+	tests := []struct {
+		name       string
+		provider   *oidcProvider
+		claims     map[string]any
+		wantUser   string
+		wantGroups []string
+		wantStatus int
+	}{
+		{
+			name:       "verified email",
+			provider:   emailProvider,
+			claims:     map[string]any{"email": "alice@example.com", "email_verified": true, "groups": []any{"developers"}},
+			wantUser:   "alice@example.com",
+			wantGroups: []string{"system:authenticated", "developers"},
+		},
+		{
+			name:       "unverified email",
+			provider:   emailProvider,
+			claims:     map[string]any{"email": "alice@example.com", "email_verified": false},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "email without email_verified",
+			provider:   emailProvider,
+			claims:     map[string]any{"email": "alice@example.com"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "email_verified as a string",
+			provider:   emailProvider,
+			claims:     map[string]any{"email": "alice@example.com", "email_verified": "true"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "other username claim needs no verified email",
+			provider:   subProvider,
+			claims:     map[string]any{"sub": "1234", "email": "alice@example.com"},
+			wantUser:   "1234",
+			wantGroups: []string{"system:authenticated"},
+		},
+		{
+			name:       "no username claim",
+			provider:   subProvider,
+			claims:     map[string]any{"email": "alice@example.com"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "prefixes",
+			provider:   prefixedProvider,
+			claims:     map[string]any{"email": "alice@example.com", "email_verified": true, "groups": []any{"system:masters"}},
+			wantUser:   "oidc:alice@example.com",
+			wantGroups: []string{"system:authenticated", "oidc:system:masters"},
+		},
+		{
+			name:       "control characters in the username",
+			provider:   subProvider,
+			claims:     map[string]any{"sub": "alice\nadmin"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "control characters in a group",
+			provider:   subProvider,
+			claims:     map[string]any{"sub": "alice", "groups": []any{"developers", "ops\x00"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "long group",
+			provider:   subProvider,
+			claims:     map[string]any{"sub": "alice", "groups": []any{strings.Repeat("g", maxInputLength+1)}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.provider.claimsIdentity(tt.claims)
+			if tt.wantStatus != 0 {
+				if err == nil {
+					t.Fatalf("claims %v were accepted as %s, want status %d", tt.claims, id.User, tt.wantStatus)
+				}
+				if err.Status != tt.wantStatus {
+					t.Errorf("claims %v were rejected with %d (%s), want %d", tt.claims, err.Status, err.Message, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("claims %v were rejected: %s", tt.claims, err.Message)
+			}
+			if id.User != tt.wantUser || !slices.Equal(id.Groups, tt.wantGroups) {
+				t.Errorf("claims %v gave %s %v, want %s %v", tt.claims, id.User, id.Groups, tt.wantUser, tt.wantGroups)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdleTTL is how long a client's limiter is kept after its last
+// request.
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// clientLimiter is the token bucket of a single client IP.
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipRateLimiter hands out a token bucket per client IP.
+type ipRateLimiter struct {
+	rps   rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastPrune time.Time
+}
+
+// newIPRateLimiter creates a limiter allowing rps requests per second per IP.
+func newIPRateLimiter(rps float64) *ipRateLimiter {
+	return &ipRateLimiter{
+		rps:     rate.Limit(rps),
+		burst:   max(1, int(math.Ceil(rps))),
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+// limiter returns the token bucket for ip, creating it on first use. Buckets
+// of clients that have been idle for a while are dropped along the way.
+func (l *ipRateLimiter) limiter(ip string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) > rateLimiterIdleTTL {
+		for key, client := range l.clients {
+			if now.Sub(client.lastSeen) > rateLimiterIdleTTL {
+				delete(l.clients, key)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	client, ok := l.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.clients[ip] = client
+	}
+	client.lastSeen = now
+	return client.limiter
+}
+
+// rateLimit rejects requests from clients that exceed their rate with 429,
+// telling them when to retry. Routes whose full path is in exempt aren't
+// limited.
+func rateLimit(l *ipRateLimiter, exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(exempt, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		reservation := l.limiter(c.ClientIP(), now).ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			respondError(c, http.StatusTooManyRequests, codeRateLimited, "Too many requests")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recovery turns a panicking handler into a 500 in the app's own error
+// format, logging the panic and its stack with the request ID. Panics with
+// http.ErrAbortHandler are left to net/http, which uses them to abort a
+// response on purpose.
+func recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			panicsTotal.Inc()
+			requestLog(c.Request.Context()).Error("Handler panicked", "panic", recovered, "method", c.Request.Method, "path", c.Request.URL.Path, "stack", string(debug.Stack()))
+
+			// A partly written response can't be replaced by an error page
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			respondError(c, http.StatusInternalServerError, codeInternal, "Internal server error")
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Ways of matching ACCESS_ROLE entries against role names, selectable with
+// AUTHZ_MATCH_MODE.
+const (
+	roleMatchExact = "exact"
+	// roleMatchGlob treats * as any run of characters and ? as any one
+	roleMatchGlob = "glob"
+	// roleMatchRegex treats entries as regular expressions matching the
+	// whole role name
+	roleMatchRegex = "regex"
+)
+
+// roleMatcher decides whether a role name is one of the required roles. Glob
+// and regular expression entries are compiled once, when it is created.
+type roleMatcher struct {
+	names    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// newRoleMatcher returns the matcher of roles in mode, or an error naming the
+// first entry that isn't a valid pattern.
+func newRoleMatcher(mode string, roles []string) (roleMatcher, error) {
+	if mode != roleMatchExact && mode != roleMatchGlob && mode != roleMatchRegex {
+		return roleMatcher{}, fmt.Errorf("unknown role match mode %q, expected %q, %q or %q", mode, roleMatchExact, roleMatchGlob, roleMatchRegex)
+	}
+
+	m := roleMatcher{names: make(map[string]bool)}
+	for _, role := range roles {
+		expr := role
+		switch mode {
+		case roleMatchExact:
+			m.names[role] = true
+			continue
+		case roleMatchGlob:
+			expr = globToRegexp(role)
+		}
+
+		pattern, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return roleMatcher{}, fmt.Errorf("access role %q is not a valid %s pattern: %w", role, mode, err)
+		}
+		m.patterns = append(m.patterns, pattern)
+	}
+	return m, nil
+}
+
+// globToRegexp converts a glob of * and ? wildcards to a regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// matches reports whether role is one of the required roles.
+func (m roleMatcher) matches(role string) bool {
+	if m.names[role] {
+		return true
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(role) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// missingRequiredRoles returns the ACCESS_ROLE roles that exist neither as a
+// ClusterRole nor, with TARGET_NAMESPACE set, as a Role in that namespace. No
+// binding can grant a missing role, so every user is denied until it is
+// created. Roles that can't be looked up, such as when the app may not get
+// ClusterRoles, are assumed to exist, as are glob and regex patterns, which
+// may well match roles created later.
+func (s *Server) missingRequiredRoles(ctx context.Context, clientset kubernetes.Interface) []string {
+	if s.cfg.AuthzMatchMode != roleMatchExact {
+		return nil
+	}
+
+	var missing []string
+	for _, role := range s.cfg.RequiredRoles {
+		_, err := clientset.RbacV1().ClusterRoles().Get(ctx, role, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) && s.cfg.TargetNamespace != "" {
+			_, err = clientset.RbacV1().Roles(s.cfg.TargetNamespace).Get(ctx, role, metav1.GetOptions{})
+		}
+		switch {
+		case apierrors.IsNotFound(err):
+			missing = append(missing, role)
+		case err != nil:
+			slog.Debug("Failed to look up required role", "role", role, "error", err)
+		}
+	}
+	return missing
+}
+
+// warnMissingRequiredRoles logs a warning for each required role that doesn't
+// exist in the default context's cluster, as a typo'd ACCESS_ROLE otherwise
+// silently denies everyone.
+func (s *Server) warnMissingRequiredRoles() {
+	if s.cfg.AccessResource != "" || len(s.cfg.RequiredRoles) == 0 || s.cfg.AuthzMatchMode != roleMatchExact {
+		return
+	}
+
+	clientset, err := s.clientsets.Clientset("")
+	if err != nil {
+		slog.Warn("Failed to create Kubernetes clientset to check required roles", "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.APITimeout)
+	defer cancel()
+
+	for _, role := range s.missingRequiredRoles(ctx, clientset) {
+		slog.Warn("Required role does not exist, every user will be denied until it is created", "role", role, "namespace", s.cfg.TargetNamespace)
+	}
+}
@@ -0,0 +1,464 @@
+// Package server implements the kubeauth HTTP server: context selection,
+// session handling and the RBAC-gated home page.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// inClusterContext is the context name used for the pod's own service account.
+const inClusterContext = "in-cluster"
+
+// Server holds the dependencies shared by the HTTP handlers.
+type Server struct {
+	cfg        Config
+	store      sessions.Store
+	clientsets ClientsetFactory
+
+	// kubeConfigMu guards kubeConfig, contexts, invalidContexts and
+	// kubeConfigErr, which are replaced when the kubeconfig files change. A
+	// loaded config is never modified. kubeConfigErr is why the kubeconfig
+	// failed to load at startup, until it loads.
+	kubeConfigPaths []string
+	kubeConfigMu    sync.RWMutex
+	kubeConfig      *clientcmdapi.Config
+	contexts        []contextInfo
+	invalidContexts map[string]error
+	kubeConfigErr   error
+
+	// inClusterConfig is set when running in a pod without a kubeconfig
+	inClusterConfig   *rest.Config
+	inClusterIdentity identity
+
+	crbInformers *crbInformerCache
+
+	oidc          *oidcProvider
+	github        *githubProvider
+	requiredRoles roleMatcher
+	// requiredBindings holds ClusterRoleBinding names and RoleBinding
+	// namespace/name keys
+	requiredBindings map[string]bool
+	adminRoles       map[string]bool
+	subjects         subjectMatcher
+	audit            *slog.Logger
+	denyWebhook      *denyWebhook
+	userMapping      *userMapping
+	streams          bindingStreams
+	templates        *template.Template
+
+	// authzCache is nil when caching is disabled
+	authzCache *authzCache
+}
+
+// New loads the kubeconfig, or the in-cluster config when there is none, and
+// returns a Server configured by cfg.
+func New(cfg Config) (*Server, error) {
+	return newServer(cfg, nil)
+}
+
+// newServer is New with the clientsets of the contexts coming from
+// clientsets, such as fake clientsets in tests, unless it is nil.
+func newServer(cfg Config, clientsets ClientsetFactory) (*Server, error) {
+	s := &Server{
+		cfg:              cfg,
+		kubeConfig:       clientcmdapi.NewConfig(),
+		contexts:         []contextInfo{},
+		requiredBindings: make(map[string]bool),
+		adminRoles:       make(map[string]bool),
+		subjects:         subjectMatcher{caseInsensitive: cfg.AuthzCaseInsensitive},
+		streams:          newBindingStreams(),
+	}
+
+	store, err := newSessionStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+
+	s.templates, err = loadTemplates(cfg.TemplatesDir, cfg.BasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := newAuditLogger(cfg.AuditLogPath)
+	if err != nil {
+		return nil, err
+	}
+	s.audit = audit
+
+	s.userMapping, err = loadUserMapping(cfg.UserMappingFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DenyWebhookURL != "" {
+		s.denyWebhook = newDenyWebhook(cfg.DenyWebhookURL)
+	}
+
+	if cfg.AuthzCacheTTL > 0 {
+		s.authzCache = newAuthzCache(cfg.AuthzCacheTTL)
+	}
+
+	// Holding any one of the required roles grants access
+	s.requiredRoles, err = newRoleMatcher(cfg.AuthzMatchMode, cfg.RequiredRoles)
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range cfg.RequiredBindings {
+		s.requiredBindings[binding] = true
+	}
+	for _, role := range cfg.AdminRoles {
+		s.adminRoles[role] = true
+	}
+
+	if cfg.InsecureSkipTLSVerify {
+		slog.Warn("INSECURE: TLS verification of the Kubernetes API server is disabled, never use INSECURE_SKIP_TLS_VERIFY outside development")
+	}
+
+	// Determine which kubeconfig files to load and merge them
+	if cfg.KubeConfigDir == "" {
+		s.kubeConfigPaths = resolveKubeConfigPaths(cfg.KubeConfigPath)
+	}
+	// A broken kubeconfig leaves no contexts to select rather than stopping
+	// the process, /readyz reports it until it is fixed and reloaded
+	found, err := s.reloadKubeConfig()
+	if err != nil {
+		slog.Error("Failed to load kubeconfig, proceeding without contexts", "paths", s.kubeConfigPaths, "dir", cfg.KubeConfigDir, "error", err)
+		s.kubeConfigErr = err
+	} else if !found {
+		slog.Warn("No kubeconfig found, proceeding without kubeconfig", "paths", s.kubeConfigPaths, "dir", cfg.KubeConfigDir)
+	}
+
+	// Fall back to the pod's service account when running inside a cluster,
+	// but not in place of a kubeconfig that is there and broken
+	if !found && s.kubeConfigErr == nil && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if err := s.loadInClusterConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Clientsets are built once per context and shared between requests
+	if clientsets == nil {
+		clientsets = newClientsetCache(s.restConfig)
+	}
+	s.clientsets = clientsets
+
+	// ClusterRoleBindings are kept in memory by an informer per context. The
+	// default context's is started right away so /readyz can wait for it
+	s.crbInformers = newCRBInformerCache(s.clientsets)
+	s.startDefaultInformer()
+
+	// Catch a misspelled ACCESS_ROLE without holding up startup
+	go s.warnMissingRequiredRoles()
+
+	// Optional OIDC login as an alternative identity source
+	s.oidc, err = newOIDCProvider(context.Background(), cfg.OIDC, cfg.BasePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up OIDC: %w", err)
+	}
+	s.github = newGitHubProvider(cfg.GitHub, cfg.BasePath)
+
+	return s, nil
+}
+
+// reloadKubeConfig loads and merges the kubeconfig files and swaps them in.
+// It reports whether any kubeconfig file was found; when none is, the current
+// config is kept.
+func (s *Server) reloadKubeConfig() (bool, error) {
+	kubeConfig, err := s.loadKubeConfig()
+	if err != nil {
+		return false, err
+	}
+	if kubeConfig == nil {
+		return false, nil
+	}
+
+	// Report bad certificates now rather than on the first request
+	invalidContexts := validateKubeConfig(kubeConfig, time.Now())
+
+	s.kubeConfigMu.Lock()
+	s.kubeConfig = kubeConfig
+	s.contexts = contextList(kubeConfig)
+	s.invalidContexts = invalidContexts
+	s.kubeConfigErr = nil
+	s.kubeConfigMu.Unlock()
+	return true, nil
+}
+
+// loadKubeConfig loads the kubeconfig files of KUBECONFIG_DIR when it is set,
+// or else of KUBECONFIG. It returns nil when there are none.
+func (s *Server) loadKubeConfig() (*clientcmdapi.Config, error) {
+	if s.cfg.KubeConfigDir != "" {
+		kubeConfig, err := loadKubeConfigDir(s.cfg.KubeConfigDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig directory: %w", err)
+		}
+		return kubeConfig, nil
+	}
+
+	kubeConfigBytes, err := loadKubeConfig(s.kubeConfigPaths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if kubeConfigBytes == nil {
+		return nil, nil
+	}
+
+	kubeConfig, err := clientcmd.Load(kubeConfigBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+	return kubeConfig, nil
+}
+
+// startDefaultInformer starts the ClusterRoleBinding informer of the default
+// context, unless authorization doesn't use bindings or there is no context.
+func (s *Server) startDefaultInformer() {
+	_, contexts := s.currentKubeConfig()
+	if s.cfg.AccessResource != "" || (s.inClusterConfig == nil && len(contexts) == 0) {
+		return
+	}
+	if _, err := s.crbInformers.informer(s.defaultContext()); err != nil {
+		slog.Warn("Failed to start ClusterRoleBinding informer", "error", err)
+	}
+}
+
+// defaultContext returns the name of the context used when none is selected.
+func (s *Server) defaultContext() string {
+	if s.inClusterConfig != nil {
+		return inClusterContext
+	}
+	kubeConfig, _ := s.currentKubeConfig()
+	return kubeConfig.CurrentContext
+}
+
+// currentKubeConfig returns the loaded kubeconfig and its contexts.
+func (s *Server) currentKubeConfig() (*clientcmdapi.Config, []contextInfo) {
+	s.kubeConfigMu.RLock()
+	defer s.kubeConfigMu.RUnlock()
+	return s.kubeConfig, s.contexts
+}
+
+// kubeConfigError returns why the kubeconfig failed to load, or nil once it
+// has loaded.
+func (s *Server) kubeConfigError() error {
+	s.kubeConfigMu.RLock()
+	defer s.kubeConfigMu.RUnlock()
+	return s.kubeConfigErr
+}
+
+// contextError returns why the named context's certificates can't be used,
+// or nil when they are valid.
+func (s *Server) contextError(contextName string) error {
+	s.kubeConfigMu.RLock()
+	defer s.kubeConfigMu.RUnlock()
+	return s.invalidContexts[contextName]
+}
+
+// loadInClusterConfig configures the server to use the pod's service account.
+// A missing in-cluster config is logged and leaves the server without one.
+func (s *Server) loadInClusterConfig() error {
+	inClusterConfig, err := rest.InClusterConfig()
+	if err != nil {
+		slog.Warn("Failed to load in-cluster config, proceeding without kubeconfig", "error", err)
+		return nil
+	}
+	s.setRateLimits(inClusterConfig)
+
+	user, err := serviceAccountUsername(inClusterConfig.BearerToken)
+	if err != nil {
+		return fmt.Errorf("failed to determine service account identity: %w", err)
+	}
+
+	namespace, _, ok := splitServiceAccountUsername(user)
+	if !ok {
+		return fmt.Errorf("unexpected service account identity %q", user)
+	}
+
+	slog.Info("Running in-cluster", "user", user)
+	s.inClusterConfig = inClusterConfig
+	s.inClusterIdentity = identity{
+		User:           user,
+		Groups:         serviceAccountGroups(namespace),
+		Kind:           rbacv1.ServiceAccountKind,
+		Context:        inClusterContext,
+		Cluster:        inClusterContext,
+		OwnCredentials: true,
+	}
+	return nil
+}
+
+// path returns the URL path of the app's route p under the base path.
+func (s *Server) path(p string) string {
+	return s.cfg.BasePath + p
+}
+
+// restConfig returns the in-cluster config when available and otherwise
+// builds one from the cluster, user and certificates of the named kubeconfig
+// context. An empty contextName selects the kubeconfig's current context.
+func (s *Server) restConfig(contextName string) (*rest.Config, error) {
+	if s.inClusterConfig != nil {
+		return s.inClusterConfig, nil
+	}
+	kubeConfig, _ := s.currentKubeConfig()
+	if len(kubeConfig.Contexts) == 0 {
+		return nil, errors.New("no kubeconfig or in-cluster config available")
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveClientConfig(*kubeConfig, contextName, s.configOverrides(), nil)
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	s.setRateLimits(restConfig)
+	return restConfig, nil
+}
+
+// setRateLimits applies the configured client-side rate limits to restConfig.
+func (s *Server) setRateLimits(restConfig *rest.Config) {
+	restConfig.QPS = float32(s.cfg.KubeQPS)
+	restConfig.Burst = s.cfg.KubeBurst
+}
+
+// configOverrides returns the configured replacements for the API server URL
+// and CA of every context, so a kubeconfig written for one network can be used
+// from another.
+func (s *Server) configOverrides() *clientcmd.ConfigOverrides {
+	// An overriding CA file also replaces any CA data inlined in the kubeconfig,
+	// as does skipping verification
+	overrides := &clientcmd.ConfigOverrides{}
+	overrides.ClusterInfo.Server = s.cfg.APIServerOverride
+	overrides.ClusterInfo.CertificateAuthority = s.cfg.CAFile
+	overrides.ClusterInfo.InsecureSkipTLSVerify = s.cfg.InsecureSkipTLSVerify
+	return overrides
+}
+
+// Handler returns the gin engine serving all routes.
+func (s *Server) Handler() *gin.Engine {
+	router := gin.New()
+	// Only proxies in TRUSTED_PROXIES may set the client IP with
+	// X-Forwarded-For, otherwise any client could dodge the rate limit and
+	// forge the logged IP. Config validation has checked every entry
+	if err := router.SetTrustedProxies(s.cfg.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted proxies", "error", err)
+	}
+	// Recovery runs inside the logging and metrics so a panic is counted as a 500
+	router.Use(requestID(), requestLogger(), metricsMiddleware(), recovery())
+
+	// Prometheus metrics, scraped without a session
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Probes
+	router.GET("/healthz", s.handleHealthz)
+	router.GET("/readyz", s.handleReadyz)
+
+	// Build metadata, for checking rollouts
+	router.GET("/version", s.handleVersion)
+
+	// Everything past the probes and metrics is rate limited per client IP,
+	// except for /auth: every subrequest of a forward-auth proxy comes from
+	// the proxy's own IP
+	if s.cfg.RateLimitRPS > 0 {
+		router.Use(rateLimit(newIPRateLimiter(s.cfg.RateLimitRPS), s.path("/auth")))
+	}
+	router.Use(requestTimeout(s.cfg.RequestTimeout, s.path("/home/stream")))
+
+	// Set up session store using cookies
+	router.Use(sessions.Sessions(s.cfg.SessionCookieName, s.store))
+
+	// Behind mutual TLS, the client certificate identifies the user
+	if s.cfg.ClientCertAuth != "" {
+		router.Use(s.clientCertAuth())
+	}
+
+	// The app's own routes live under the base path when behind a proxy
+	// serving it at a subpath; probes and metrics stay at the root
+	root := router.Group(s.cfg.BasePath)
+
+	if s.oidc != nil {
+		root.GET("/login/oidc", s.oidc.handleLogin)
+		root.GET("/callback", s.oidc.handleCallback)
+	}
+	if s.github != nil {
+		root.GET("/login/github", s.github.handleLogin)
+		root.GET("/callback/github", s.github.handleCallback)
+	}
+
+	// The caller's identity, for frontends and debugging
+	root.GET("/whoami", jsonErrors(), s.bearerAuth(), s.requireAuth(respondUnauthorized), s.handleWhoami)
+
+	// Re-checks the caller's access past the authorization cache. It only
+	// drops a cached decision, so it needs no CSRF token
+	root.POST("/refresh", jsonErrors(), s.bearerAuth(), s.requireAuth(respondUnauthorized), s.handleRefresh)
+
+	// External authorization for proxies, decided by status and headers only
+	root.GET("/auth", s.bearerAuth(), s.requireAuth(respondAuthStatus), s.handleAuth)
+
+	// Admins can find out why a user is allowed or denied
+	root.GET("/debug/authz", jsonErrors(), s.bearerAuth(), s.requireAuth(respondUnauthorized), s.handleDebugAuthz)
+
+	// Admins can check which settings took effect
+	root.GET("/config", jsonErrors(), s.bearerAuth(), s.requireAuth(respondUnauthorized), s.handleConfig)
+
+	// HTML pages, forms must carry the session's CSRF token
+	pages := root.Group("/", csrfProtect())
+	pages.GET("/", s.handleIndex)
+	pages.POST("/select-context", s.handleSelectContext)
+	pages.POST("/logout", s.handleLogout)
+
+	// In MULTI_CLUSTER mode the home page sums up every cluster instead
+	home, apiHome := s.handleHome, s.handleAPIHome
+	if s.cfg.MultiCluster {
+		home, apiHome = s.handleClusters, s.handleAPIClusters
+	}
+
+	// Pages that require a logged in session
+	protected := pages.Group("/", s.requireAuth(s.redirectToIndex))
+	protected.GET("/home", home)
+	protected.GET("/home/stream", s.handleHomeStream)
+	protected.GET("/my-access", s.handleMyAccess)
+	protected.POST("/switch-context", s.handleSwitchContext)
+	protected.GET("/namespaces", s.handleNamespaces)
+	protected.POST("/select-namespace", s.handleSelectNamespace)
+
+	// JSON API mirroring the HTML flow, sharing the same session. It only
+	// accepts JSON bodies, which cross-site forms cannot send, so it is exempt
+	// from the CSRF token check. Scripts can authenticate with a bearer token
+	// instead of the session
+	api := root.Group("/api/v1")
+	if len(s.cfg.CORSAllowedOrigins) > 0 {
+		// Preflights have no route of their own, answer them for every API path
+		api.Use(apiCORS(s.cfg.CORSAllowedOrigins))
+		api.OPTIONS("/*path", func(c *gin.Context) {})
+	}
+	api.Use(jsonErrors(), s.bearerAuth())
+	api.GET("/contexts", s.handleAPIContexts)
+	api.POST("/select-context", s.handleAPISelectContext)
+
+	apiProtected := api.Group("/", s.requireAuth(respondUnauthorized))
+	apiProtected.GET("/home", apiHome)
+	apiProtected.GET("/my-access", s.handleAPIMyAccess)
+	apiProtected.POST("/switch-context", s.handleAPISwitchContext)
+	apiProtected.GET("/namespaces", s.handleAPINamespaces)
+	apiProtected.POST("/select-namespace", s.handleAPISelectNamespace)
+
+	// HTML templates, parsed when the server was created
+	router.SetHTMLTemplate(s.templates)
+
+	return router
+}
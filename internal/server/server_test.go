@@ -0,0 +1,210 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/biodigitalJaz/web-kubeauth/internal/kubeconfigtest"
+	"k8s.io/client-go/kubernetes"
+)
+
+// testSessionSecret signs the session cookies of test servers.
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
+// testContext is the context of the kubeconfig written by testConfig, and
+// testContextUser its user, who authenticates with a client certificate in
+// the testers group.
+const (
+	testContext     = "dev"
+	testContextUser = "alice"
+)
+
+// fakeClientsets is a ClientsetFactory handing out the clientset of each
+// context, such as a fake clientset from client-go.
+type fakeClientsets map[string]kubernetes.Interface
+
+// testClientsets returns the clientsets of a server whose only context,
+// testContext, uses clientset. The empty name is the current context.
+func testClientsets(clientset kubernetes.Interface) fakeClientsets {
+	return fakeClientsets{"": clientset, testContext: clientset}
+}
+
+func (f fakeClientsets) Clientset(contextName string) (kubernetes.Interface, error) {
+	clientset, ok := f[contextName]
+	if !ok {
+		return nil, fmt.Errorf("no clientset for context %q", contextName)
+	}
+	return clientset, nil
+}
+
+// writeKubeConfig writes a kubeconfig of users and contexts, with a cluster
+// for each context named after it, to a temporary file and returns its path.
+func writeKubeConfig(t *testing.T, users []kubeconfigtest.User, contexts []kubeconfigtest.Context) string {
+	t.Helper()
+
+	var clusters []kubeconfigtest.Cluster
+	for _, kubeContext := range contexts {
+		clusters = append(clusters, kubeconfigtest.Cluster{Name: kubeContext.Cluster, Server: "https://" + kubeContext.Cluster + ".example.com"})
+	}
+	data, err := kubeconfigtest.YAML(clusters, users, contexts)
+	if err != nil {
+		t.Fatalf("failed to build kubeconfig: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+// testConfig returns the config of a test server using a kubeconfig with the
+// single context testContext of testContextUser, requiring one of
+// requiredRoles.
+func testConfig(t *testing.T, requiredRoles ...string) Config {
+	t.Helper()
+
+	cfg := defaultConfig()
+	cfg.SessionSecret = testSessionSecret
+	cfg.CookieSecure = false
+	cfg.RateLimitRPS = 0
+	cfg.AuthzCacheTTL = 0
+	cfg.RequiredRoles = requiredRoles
+	cfg.KubeConfigPath = writeKubeConfig(t,
+		[]kubeconfigtest.User{{Name: testContextUser, Groups: []string{"testers"}}},
+		[]kubeconfigtest.Context{{Name: testContext, Cluster: testContext, User: testContextUser}},
+	)
+	return cfg
+}
+
+// newTestServer returns a server configured by cfg whose contexts use the
+// clientsets of clientsets, stopping its informers when the test ends.
+func newTestServer(t *testing.T, cfg Config, clientsets ClientsetFactory) *Server {
+	t.Helper()
+
+	s, err := newServer(cfg, clientsets)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	t.Cleanup(func() {
+		s.CloseStreams()
+		s.crbInformers.reset()
+	})
+	return s
+}
+
+// testClient makes requests to a test server with a cookie jar, without
+// following redirects.
+type testClient struct {
+	t      *testing.T
+	server *httptest.Server
+	client *http.Client
+}
+
+// newTestClient serves the routes of s for the duration of the test.
+func newTestClient(t *testing.T, s *Server) *testClient {
+	t.Helper()
+
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("failed to create cookie jar: %v", err)
+	}
+	return &testClient{
+		t:      t,
+		server: server,
+		client: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// do sends a request to path with the given headers and returns the response
+// and its body.
+func (c *testClient) do(method, path string, body string, header http.Header) (*http.Response, string) {
+	c.t.Helper()
+
+	req, err := http.NewRequest(method, c.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatalf("failed to create request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	text, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("failed to read response of %s %s: %v", method, path, err)
+	}
+	return resp, string(text)
+}
+
+// get sends a GET request to path.
+func (c *testClient) get(path string, header http.Header) (*http.Response, string) {
+	c.t.Helper()
+	return c.do(http.MethodGet, path, "", header)
+}
+
+// postForm submits form to path with the session's CSRF token.
+func (c *testClient) postForm(path string, form url.Values) (*http.Response, string) {
+	c.t.Helper()
+
+	form.Set(csrfFormField, c.csrfToken())
+	return c.do(http.MethodPost, path, form.Encode(), http.Header{"Content-Type": {"application/x-www-form-urlencoded"}})
+}
+
+// csrfTokenPattern finds the CSRF token in the context selection form.
+var csrfTokenPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// csrfToken loads the context selection page and returns its CSRF token.
+func (c *testClient) csrfToken() string {
+	c.t.Helper()
+
+	_, body := c.get("/", nil)
+	match := csrfTokenPattern.FindStringSubmatch(body)
+	if match == nil {
+		c.t.Fatalf("no CSRF token on the context selection page:\n%s", body)
+	}
+	return match[1]
+}
+
+// login selects context with the context selection form.
+func (c *testClient) login(context string) {
+	c.t.Helper()
+
+	resp, body := c.postForm("/select-context", url.Values{"context": {context}})
+	if resp.StatusCode != http.StatusFound {
+		c.t.Fatalf("selecting context %s returned %d, want %d:\n%s", context, resp.StatusCode, http.StatusFound, body)
+	}
+}
+
+// sessionCookie returns the session cookie the client holds, if any.
+func (c *testClient) sessionCookie() *http.Cookie {
+	serverURL, _ := url.Parse(c.server.URL)
+	for _, cookie := range c.client.Jar.Cookies(serverURL) {
+		if cookie.Name == defaultSessionCookieName {
+			return cookie
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-contrib/sessions/redis"
+	"github.com/gin-gonic/gin"
+)
+
+// identity is who a session is authenticated as and which kubeconfig context
+// its requests are made against.
+type identity struct {
+	User    string
+	Groups  []string
+	Kind    string
+	Context string
+	Cluster string
+
+	// ImpersonatedBy is the admin acting as this identity, if any. It is
+	// never stored in the session.
+	ImpersonatedBy string
+	// OwnCredentials is set when the identity's Kubernetes requests are made
+	// with its own credentials, such as its bearer token, rather than the
+	// app's, so the API server can be asked what it may do directly.
+	OwnCredentials bool
+}
+
+// Session keys of when the session logged in and when it was last used, as
+// Unix seconds.
+const (
+	authenticatedAtSessionKey = "authenticated_at"
+	lastSeenSessionKey        = "last_seen"
+)
+
+// Session backends selectable with SESSION_BACKEND.
+const (
+	sessionBackendCookie = "cookie"
+	sessionBackendMemory = "memory"
+	sessionBackendRedis  = "redis"
+)
+
+// redisPoolSize is the number of idle connections kept to Redis.
+const redisPoolSize = 10
+
+// newSessionStore creates the session store of the configured backend: signed
+// cookies holding the session itself, or process memory or Redis holding it
+// server-side behind a signed session ID cookie. Cookies are signed with the
+// session secret; when a previous secret is configured, cookies signed with
+// it are still accepted so the key can be rotated without logging anyone out:
+//
+//  1. Set SESSION_SECRET_PREVIOUS to the current secret and SESSION_SECRET to
+//     a new one, and restart. New cookies are signed with the new secret.
+//  2. Wait for the rotation window: cookies are re-signed with the new secret
+//     whenever they are saved, which every authenticated request does, and
+//     those left untouched expire after SESSION_MAX_AGE.
+//  3. Unset SESSION_SECRET_PREVIOUS and restart, which logs out the sessions
+//     still signed with the old secret.
+func newSessionStore(cfg Config) (sessions.Store, error) {
+	// Key pairs are (hash key, block key); only the hash key is used. The
+	// first pair signs, every pair is tried when verifying
+	keyPairs := [][]byte{[]byte(cfg.SessionSecret), nil}
+	if cfg.SessionSecretPrevious != "" {
+		keyPairs = append(keyPairs, []byte(cfg.SessionSecretPrevious), nil)
+	}
+
+	var store sessions.Store
+	switch cfg.SessionBackend {
+	case sessionBackendRedis:
+		redisStore, err := redis.NewStore(redisPoolSize, "tcp", cfg.RedisAddr, cfg.RedisPassword, keyPairs...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to Redis at %s: %w", cfg.RedisAddr, err)
+		}
+		store = redisStore
+	case sessionBackendMemory:
+		store = newMemoryStore(keyPairs...)
+	default:
+		store = cookie.NewStore(keyPairs...)
+	}
+
+	// Browsers only send the cookie cross-site to the allowed CORS origins
+	// when SameSite is None, the pages' forms are still CSRF protected
+	sameSite := http.SameSiteLaxMode
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		sameSite = http.SameSiteNoneMode
+	}
+
+	// Secure should only be disabled for local development over plain HTTP
+	store.Options(sessions.Options{
+		Path:     cookiePath(cfg.BasePath),
+		MaxAge:   int(cfg.SessionMaxAge.Seconds()),
+		Secure:   cfg.CookieSecure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+
+	return store, nil
+}
+
+// isAuthenticated reports whether the session belongs to a logged in user. A
+// session marked authenticated without a user is treated as logged out.
+func isAuthenticated(session sessions.Session) bool {
+	user, ok := session.Get("user").(string)
+	return session.Get("authenticated") == true && ok && user != ""
+}
+
+// requireAuth lets only authenticated sessions, or requests authenticated by
+// a bearer token or client certificate, through to the routes it guards.
+// Sessions idle for longer than SESSION_IDLE_TIMEOUT, or logged in for longer
+// than SESSION_MAX_AGE however active, are logged out. Unauthenticated
+// requests are handled by unauthenticated instead.
+func (s *Server) requireAuth(unauthenticated gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(requestAuthKey); ok {
+			c.Next()
+			return
+		}
+
+		session := sessions.Default(c)
+		if !isAuthenticated(session) {
+			unauthenticated(c)
+			c.Abort()
+			return
+		}
+
+		logger := requestLog(c.Request.Context())
+		now := time.Now()
+		if reason := s.sessionExpiry(session, now); reason != "" {
+			logger.Info("Session expired", "user", session.Get("user"), "reason", reason)
+			if err := clearSession(session, s.cfg.BasePath); err != nil {
+				logger.Error("Failed to clear session", "error", err)
+			}
+			unauthenticated(c)
+			c.Abort()
+			return
+		}
+
+		// Saving also refreshes the cookie, whose MaxAge would otherwise run
+		// out from the login
+		session.Set(lastSeenSessionKey, now.Unix())
+		if _, ok := session.Get(authenticatedAtSessionKey).(int64); !ok {
+			// Sessions from before the login time was stored start now
+			session.Set(authenticatedAtSessionKey, now.Unix())
+		}
+		if err := session.Save(); err != nil {
+			logger.Error("Failed to save session", "error", err)
+		}
+		c.Next()
+	}
+}
+
+// sessionExpiry returns why the session is no longer valid at now, or "" when
+// it still is.
+func (s *Server) sessionExpiry(session sessions.Session, now time.Time) string {
+	if authenticatedAt, ok := session.Get(authenticatedAtSessionKey).(int64); ok && now.Sub(time.Unix(authenticatedAt, 0)) > s.cfg.SessionMaxAge {
+		return "max age"
+	}
+	if lastSeen, ok := session.Get(lastSeenSessionKey).(int64); ok && s.cfg.SessionIdleTimeout > 0 && now.Sub(time.Unix(lastSeen, 0)) > s.cfg.SessionIdleTimeout {
+		return "idle"
+	}
+	return ""
+}
+
+// redirectToIndex sends the browser back to the context selection page to log
+// in. Clients asking for JSON can't follow the login flow and get a 401
+// instead.
+func (s *Server) redirectToIndex(c *gin.Context) {
+	if wantsJSON(c) {
+		respondUnauthorized(c)
+		return
+	}
+	c.Redirect(http.StatusFound, s.path("/"))
+}
+
+// respondUnauthorized reports a missing login to API clients. A 401 always
+// means the caller isn't logged in, while a 403 means they are but lack the
+// required access.
+func respondUnauthorized(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Bearer realm="kubeauth"`)
+	respondError(c, http.StatusUnauthorized, codeUnauthenticated, "Not authenticated")
+}
+
+// saveIdentity marks the session as authenticated as id and saves it.
+func saveIdentity(session sessions.Session, id identity) error {
+	// Store only minimal information in the session
+	session.Set("authenticated", true)
+	session.Set("user", id.User)
+	session.Set("groups", id.Groups)
+	session.Set("kind", id.Kind)
+	session.Set("context", id.Context)
+	session.Set("cluster", id.Cluster)
+	// Switching identities within a session doesn't extend its lifetime
+	now := time.Now().Unix()
+	if _, ok := session.Get(authenticatedAtSessionKey).(int64); !ok {
+		session.Set(authenticatedAtSessionKey, now)
+	}
+	session.Set(lastSeenSessionKey, now)
+	// A namespace selected for another identity may not be usable by this one
+	session.Delete(namespaceSessionKey)
+	return session.Save()
+}
+
+// sessionIdentity returns the identity stored in the session.
+func sessionIdentity(session sessions.Session) identity {
+	var id identity
+	id.User, _ = session.Get("user").(string)
+	id.Groups, _ = session.Get("groups").([]string)
+	id.Kind, _ = session.Get("kind").(string)
+	id.Context, _ = session.Get("context").(string)
+	id.Cluster, _ = session.Get("cluster").(string)
+	// Sessions of a kubeconfig context or the in-cluster service account use
+	// its credentials, OIDC and GitHub sessions have no context
+	id.OwnCredentials = id.Context != ""
+	return id
+}
+
+// clearSession logs the session out and expires its cookie, which was set
+// for basePath.
+func clearSession(session sessions.Session, basePath string) error {
+	session.Clear()
+	session.Options(sessions.Options{Path: cookiePath(basePath), MaxAge: -1, HttpOnly: true})
+	return session.Save()
+}
+
+// cookiePath returns the path the session cookie is scoped to, so apps at
+// different base paths of one host don't share it.
+func cookiePath(basePath string) string {
+	if basePath == "" {
+		return "/"
+	}
+	return basePath
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// craftedSessionCookie returns a session cookie signed by the store of s
+// holding values, as if a client had got hold of the session secret or an
+// older version had stored them.
+func craftedSessionCookie(t *testing.T, s *Server, values map[string]any) *http.Cookie {
+	t.Helper()
+
+	router := gin.New()
+	router.Use(sessions.Sessions(s.cfg.SessionCookieName, s.store))
+	router.GET("/", func(c *gin.Context) {
+		session := sessions.Default(c)
+		for key, value := range values {
+			session.Set(key, value)
+		}
+		if err := session.Save(); err != nil {
+			t.Errorf("failed to save crafted session: %v", err)
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == s.cfg.SessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatalf("crafted session set no %s cookie", s.cfg.SessionCookieName)
+	return nil
+}
+
+func TestRequireAuthMalformedSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+	}{
+		{name: "empty user", values: map[string]any{"authenticated": true, "user": ""}},
+		{name: "user of the wrong type", values: map[string]any{"authenticated": true, "user": 42}},
+		{name: "no user", values: map[string]any{"authenticated": true}},
+		{name: "authenticated of the wrong type", values: map[string]any{"authenticated": "true", "user": testContextUser}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig(t, "viewer"), testClientsets(fake.NewSimpleClientset()))
+			client := newTestClient(t, s)
+			cookie := craftedSessionCookie(t, s, tt.values).String()
+
+			resp, body := client.get("/home", http.Header{"Cookie": {cookie}})
+			if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/" {
+				t.Errorf("GET /home returned %d to %q, want a redirect to /:\n%s", resp.StatusCode, resp.Header.Get("Location"), body)
+			}
+
+			resp, body = client.get("/api/v1/home", http.Header{"Cookie": {cookie}})
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("GET /api/v1/home returned %d, want %d:\n%s", resp.StatusCode, http.StatusUnauthorized, body)
+			}
+		})
+	}
+}
+
+func TestMemorySessionRotatedOnLogin(t *testing.T) {
+	cfg := testConfig(t, "viewer")
+	cfg.SessionBackend = sessionBackendMemory
+	clientset := fake.NewSimpleClientset(clusterRoleBinding("alice-viewer", "viewer", userSubject(testContextUser)))
+	s := newTestServer(t, cfg, testClientsets(clientset))
+	client := newTestClient(t, s)
+
+	// The session a login form is served with, as an attacker could plant
+	client.csrfToken()
+	before := client.sessionCookie()
+	if before == nil {
+		t.Fatal("the context selection page set no session cookie")
+	}
+
+	client.login(testContext)
+	after := client.sessionCookie()
+	if after == nil || after.Value == before.Value {
+		t.Fatal("logging in kept the session ID of the login form")
+	}
+
+	resp, body := client.get("/api/v1/home", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /api/v1/home with the new session returned %d, want %d:\n%s", resp.StatusCode, http.StatusOK, body)
+	}
+	resp, body = newTestClient(t, s).get("/api/v1/home", http.Header{"Cookie": {before.Name + "=" + before.Value}})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /api/v1/home with the session from before the login returned %d, want %d:\n%s", resp.StatusCode, http.StatusUnauthorized, body)
+	}
+}
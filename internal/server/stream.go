@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// streamKeepAlive is how often an idle binding stream sends a comment, so
+// proxies don't close it for inactivity.
+const streamKeepAlive = 30 * time.Second
+
+// streamRecheckInterval is how often an open binding stream checks again that
+// its session hasn't expired and its user is still authorized, as the stream
+// is exempt from REQUEST_TIMEOUT and would otherwise outlive both. It is a
+// variable so tests can shorten it.
+var streamRecheckInterval = time.Minute
+
+// bindingEvent is a change to a binding, sent as a "binding" event by
+// /home/stream.
+type bindingEvent struct {
+	// Type is "added", "modified" or "deleted", or "removed" when a change
+	// left the binding without the user as a subject
+	Type      string           `json:"type"`
+	Kind      string           `json:"kind"`
+	Name      string           `json:"name"`
+	Namespace string           `json:"namespace,omitempty"`
+	Role      string           `json:"role"`
+	Subjects  []rbacv1.Subject `json:"subjects"`
+}
+
+// bindingStreams ends the open binding streams when the server shuts down,
+// as they would otherwise hold up the graceful shutdown until it times out.
+type bindingStreams struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newBindingStreams returns the stream shutdown of a new Server.
+func newBindingStreams() bindingStreams {
+	ctx, cancel := context.WithCancel(context.Background())
+	return bindingStreams{ctx: ctx, cancel: cancel}
+}
+
+// CloseStreams ends every open /home/stream response. Pass it to the HTTP
+// server's RegisterOnShutdown.
+func (s *Server) CloseStreams() {
+	s.streams.cancel()
+}
+
+// handleHomeStream pushes the changes to the bindings shown on the home page
+// as Server-Sent Events until the client disconnects, its session expires or
+// its user loses access. Only changes made after the stream began are sent,
+// the page already shows the rest. RoleBindings are left out when the user may
+// not watch them. Browsers reconnect on their own when the API server ends a
+// watch.
+func (s *Server) handleHomeStream(c *gin.Context) {
+	logger := requestLog(c.Request.Context())
+
+	id, clientset, clientErr := s.requestClient(c)
+	if clientErr != nil {
+		respondHTTPError(c, clientErr)
+		return
+	}
+
+	authzCtx, cancel := context.WithTimeout(c.Request.Context(), s.cfg.APITimeout)
+	result, authzErr := s.checkAccess(authzCtx, clientset, id)
+	cancel()
+	if authzErr != nil {
+		respondHTTPError(c, authzErr)
+		return
+	}
+	if !result.Allowed {
+		respondError(c, http.StatusForbidden, codeForbidden, s.accessDeniedMessage(result))
+		return
+	}
+
+	// The watches last as long as the client stays connected
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.streams.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	crbs, err := clientset.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		logger.Error("Failed to list ClusterRoleBindings", "context", id.Context, "error", err)
+		respondHTTPError(c, kubeAPIError(err, "Failed to list ClusterRoleBindings"))
+		return
+	}
+	crbWatch, err := clientset.RbacV1().ClusterRoleBindings().Watch(ctx, metav1.ListOptions{ResourceVersion: crbs.ResourceVersion})
+	if err != nil {
+		logger.Error("Failed to watch ClusterRoleBindings", "context", id.Context, "error", err)
+		respondHTTPError(c, kubeAPIError(err, "Failed to watch ClusterRoleBindings"))
+		return
+	}
+	defer crbWatch.Stop()
+
+	// A nil channel never receives, leaving out the RoleBindings
+	var rbEvents <-chan watch.Event
+	namespace := s.roleBindingNamespace(c)
+	rbWatch, err := watchRoleBindings(ctx, clientset, namespace)
+	if apierrors.IsForbidden(err) {
+		logger.Warn("Not allowed to watch RoleBindings", "context", id.Context, "namespace", namespace, "error", err)
+	} else if err != nil {
+		logger.Error("Failed to watch RoleBindings", "context", id.Context, "error", err)
+		respondHTTPError(c, kubeAPIError(err, "Failed to watch RoleBindings"))
+		return
+	} else {
+		defer rbWatch.Stop()
+		rbEvents = rbWatch.ResultChan()
+	}
+
+	// The bindings shown when the stream began, so a change removing the
+	// user from one of them can be reported
+	shown, err := s.streamedBindings(ctx, clientset, id, namespace, rbEvents != nil)
+	if err != nil {
+		logger.Error("Failed to list bindings", "context", id.Context, "error", err)
+		respondHTTPError(c, kubeAPIError(err, "Failed to list bindings"))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Keep nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	recheck := time.NewTicker(streamRecheckInterval)
+	defer recheck.Stop()
+
+	crbEvents := crbWatch.ResultChan()
+	c.Stream(func(w io.Writer) bool {
+		var event watch.Event
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return false
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-recheck.C:
+			if reason := s.streamRevoked(ctx, c, clientset, id); reason != "" {
+				logger.Info("Closing binding stream", "user", id.User, "context", id.Context, "reason", reason)
+				return false
+			}
+			return true
+		case event, ok = <-crbEvents:
+		case event, ok = <-rbEvents:
+		}
+		if !ok {
+			// The API server ended the watch, the browser will reconnect
+			return false
+		}
+
+		binding, ok := s.bindingEvent(event, id, shown)
+		if ok {
+			c.SSEvent("binding", binding)
+		}
+		return true
+	})
+	logger.Debug("Binding stream closed", "user", id.User, "context", id.Context)
+}
+
+// watchRoleBindings watches the RoleBindings in namespace, or in all
+// namespaces when it is empty, from their current state.
+func watchRoleBindings(ctx context.Context, clientset kubernetes.Interface, namespace string) (watch.Interface, error) {
+	rbs, err := clientset.RbacV1().RoleBindings(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	return clientset.RbacV1().RoleBindings(namespace).Watch(ctx, metav1.ListOptions{ResourceVersion: rbs.ResourceVersion})
+}
+
+// streamRevoked returns why a binding stream of id must close, or "" while it
+// may stay open. Sessions expire as they would on any other request, though
+// the stream itself doesn't count as activity.
+func (s *Server) streamRevoked(ctx context.Context, c *gin.Context, clientset kubernetes.Interface, id identity) string {
+	if _, ok := c.Get(requestAuthKey); !ok {
+		if reason := s.sessionExpiry(sessions.Default(c), time.Now()); reason != "" {
+			return "session " + reason
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.APITimeout)
+	defer cancel()
+	result, err := s.checkAccess(ctx, clientset, id)
+	if err != nil {
+		return "authorization check failed: " + err.Message
+	}
+	if !result.Allowed {
+		return "access revoked"
+	}
+	return ""
+}
+
+// bindingKey identifies a binding among both ClusterRoleBindings and
+// RoleBindings.
+func bindingKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// streamedBindings returns the keys of the bindings with id as a subject, the
+// RoleBindings among them only when withRoleBindings is set. It returns nil
+// when every binding is shown, as none can stop being shown.
+func (s *Server) streamedBindings(ctx context.Context, clientset kubernetes.Interface, id identity, namespace string, withRoleBindings bool) (map[string]bool, error) {
+	if s.cfg.ShowAllBindings {
+		return nil, nil
+	}
+
+	shown := make(map[string]bool)
+	crbs, err := s.userClusterRoleBindings(ctx, clientset, id, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, crb := range crbs {
+		shown[bindingKey("ClusterRoleBinding", "", crb.Name)] = true
+	}
+	if withRoleBindings {
+		rbs, err := s.userRoleBindings(ctx, clientset, namespace, id, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, rb := range rbs {
+			shown[bindingKey("RoleBinding", rb.Namespace, rb.Name)] = true
+		}
+	}
+	return shown, nil
+}
+
+// bindingEvent converts a watch event into the bindingEvent sent to the
+// browser. Like the home page, it only reports bindings with id as a subject
+// unless every binding is shown. shown holds the keys of the bindings
+// reported so far, and is kept up to date, so a binding that loses id as a
+// subject is reported once as removed rather than dropped.
+func (s *Server) bindingEvent(event watch.Event, id identity, shown map[string]bool) (bindingEvent, bool) {
+	var binding bindingEvent
+	switch object := event.Object.(type) {
+	case *rbacv1.ClusterRoleBinding:
+		binding = bindingEvent{Kind: "ClusterRoleBinding", Name: object.Name, Role: object.RoleRef.Name, Subjects: object.Subjects}
+	case *rbacv1.RoleBinding:
+		binding = bindingEvent{Kind: "RoleBinding", Name: object.Name, Namespace: object.Namespace, Role: object.RoleRef.Name, Subjects: object.Subjects}
+	default:
+		// Errors and bookmarks aren't changes to report
+		return bindingEvent{}, false
+	}
+
+	switch event.Type {
+	case watch.Added, watch.Modified, watch.Deleted:
+		binding.Type = strings.ToLower(string(event.Type))
+	default:
+		return bindingEvent{}, false
+	}
+	if s.cfg.ShowAllBindings {
+		return binding, true
+	}
+
+	key := bindingKey(binding.Kind, binding.Namespace, binding.Name)
+	wasShown, hasSubject := shown[key], s.subjects.hasSubject(binding.Subjects, id)
+	switch {
+	case event.Type == watch.Deleted:
+		delete(shown, key)
+		if !wasShown && !hasSubject {
+			return bindingEvent{}, false
+		}
+	case !hasSubject:
+		delete(shown, key)
+		if !wasShown {
+			return bindingEvent{}, false
+		}
+		binding.Type = "removed"
+	default:
+		shown[key] = true
+	}
+	return binding, true
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// streamTimeout bounds the wait for an event or the end of a binding stream.
+const streamTimeout = 5 * time.Second
+
+// openStream opens /home/stream as the client's session and returns the
+// binding events it sends, closed when the stream ends.
+func openStream(t *testing.T, client *testClient) <-chan bindingEvent {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, client.server.URL+"/home/stream", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := client.client.Do(req)
+	if err != nil {
+		t.Fatalf("GET /home/stream failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		t.Fatalf("GET /home/stream returned %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	events := make(chan bindingEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var name string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if value, ok := strings.CutPrefix(line, "event:"); ok {
+				name = value
+				continue
+			}
+			if value, ok := strings.CutPrefix(line, "data:"); ok && name == "binding" {
+				var event bindingEvent
+				if err := json.Unmarshal([]byte(value), &event); err != nil {
+					t.Errorf("failed to decode binding event %s: %v", value, err)
+				}
+				events <- event
+			}
+		}
+	}()
+	return events
+}
+
+// nextEvent returns the next event of events, failing the test when the
+// stream ends or sends nothing within streamTimeout.
+func nextEvent(t *testing.T, events <-chan bindingEvent) bindingEvent {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("the binding stream ended, want an event")
+		}
+		return event
+	case <-time.After(streamTimeout):
+		t.Fatal("no binding event within the timeout")
+	}
+	return bindingEvent{}
+}
+
+// waitStreamEnd fails the test unless events ends within streamTimeout,
+// skipping any events sent before.
+func waitStreamEnd(t *testing.T, events <-chan bindingEvent) {
+	t.Helper()
+
+	timeout := time.After(streamTimeout)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the binding stream is still open, want it closed")
+		}
+	}
+}
+
+// shortenStreamRecheck makes open binding streams recheck their session and
+// access often for the duration of the test.
+func shortenStreamRecheck(t *testing.T) {
+	interval := streamRecheckInterval
+	streamRecheckInterval = 20 * time.Millisecond
+	t.Cleanup(func() { streamRecheckInterval = interval })
+}
+
+func TestStreamRemovedSubject(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		clusterRoleBinding("alice-viewer", "viewer", userSubject(testContextUser)),
+		clusterRoleBinding("alice-edit", "edit", userSubject(testContextUser)),
+		clusterRoleBinding("bob-edit", "edit", userSubject("bob")),
+	)
+	client := newTestClient(t, newTestServer(t, testConfig(t, "viewer"), testClientsets(clientset)))
+	client.login(testContext)
+	events := openStream(t, client)
+
+	ctx := context.Background()
+	update := func(name string, subjects ...rbacv1.Subject) {
+		t.Helper()
+		crb, err := clientset.RbacV1().ClusterRoleBindings().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get ClusterRoleBinding %s: %v", name, err)
+		}
+		crb.Subjects = subjects
+		if _, err := clientset.RbacV1().ClusterRoleBindings().Update(ctx, crb, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("failed to update ClusterRoleBinding %s: %v", name, err)
+		}
+	}
+
+	// Bindings that never had the user as a subject aren't reported
+	update("bob-edit", userSubject("bob"), userSubject("carol"))
+	update("alice-edit", userSubject("bob"))
+	if event := nextEvent(t, events); event.Type != "removed" || event.Name != "alice-edit" {
+		t.Errorf("got a %s event of %s, want alice-edit removed", event.Type, event.Name)
+	}
+
+	// Once removed, further changes to it aren't reported either
+	update("alice-edit", userSubject("carol"))
+	update("alice-edit", userSubject(testContextUser))
+	if event := nextEvent(t, events); event.Type != "modified" || event.Name != "alice-edit" {
+		t.Errorf("got a %s event of %s, want alice-edit modified", event.Type, event.Name)
+	}
+}
+
+func TestStreamClosesOnRevokedAccess(t *testing.T) {
+	shortenStreamRecheck(t)
+	clientset := fake.NewSimpleClientset(clusterRoleBinding("alice-viewer", "viewer", userSubject(testContextUser)))
+	client := newTestClient(t, newTestServer(t, testConfig(t, "viewer"), testClientsets(clientset)))
+	client.login(testContext)
+	events := openStream(t, client)
+
+	if err := clientset.RbacV1().ClusterRoleBindings().Delete(context.Background(), "alice-viewer", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete ClusterRoleBinding alice-viewer: %v", err)
+	}
+	waitStreamEnd(t, events)
+}
+
+func TestStreamClosesOnIdleSession(t *testing.T) {
+	shortenStreamRecheck(t)
+	cfg := testConfig(t, "viewer")
+	cfg.SessionIdleTimeout = time.Second
+	clientset := fake.NewSimpleClientset(clusterRoleBinding("alice-viewer", "viewer", userSubject(testContextUser)))
+	client := newTestClient(t, newTestServer(t, cfg, testClientsets(clientset)))
+	client.login(testContext)
+
+	waitStreamEnd(t, openStream(t, client))
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+
+	"github.com/biodigitalJaz/web-kubeauth/templates"
+)
+
+// loadTemplates parses the HTML templates in dir, or the templates embedded
+// in the binary when dir is empty. A directory is only needed to try out
+// template changes without rebuilding. Templates link to pages with
+// {{path "/home"}}, which prefixes basePath.
+func loadTemplates(dir, basePath string) (*template.Template, error) {
+	root := template.New("").Funcs(template.FuncMap{
+		"path": func(p string) string { return basePath + p },
+	})
+	if dir == "" {
+		return root.ParseFS(templates.FS, "*.html")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid templates directory %q: %w", dir, err)
+	}
+	if len(matches) == 0 {
+		absDir, _ := filepath.Abs(dir)
+		return nil, fmt.Errorf("no HTML templates found in %s", absDir)
+	}
+
+	parsed, err := root.ParseFiles(matches...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML templates: %w", err)
+	}
+	return parsed, nil
+}
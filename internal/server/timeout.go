@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errRequestTimeout is the cause of a request context cancelled by
+// requestTimeout, telling it apart from the per-call API timeouts.
+var errRequestTimeout = errors.New("request timed out")
+
+// requestTimeout bounds the whole handling of a request by timeout. The
+// Kubernetes calls made for the request share its context, so they fail once
+// it has run out, and the handler's response is then replaced by a 503. This
+// caps the total of a handler's calls, each of which API_TIMEOUT only bounds
+// on its own. Requests to the routes of exempt, such as long-lived streams,
+// aren't bounded.
+func requestTimeout(timeout time.Duration, exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(exempt, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeoutCause(c.Request.Context(), timeout, errRequestTimeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if requestTimedOut(c) && !c.Writer.Written() {
+			respondError(c, http.StatusServiceUnavailable, codeRequestTimeout, "The request took too long to handle")
+		}
+	}
+}
+
+// requestTimedOut reports whether the request ran past REQUEST_TIMEOUT.
+func requestTimedOut(c *gin.Context) bool {
+	return errors.Is(context.Cause(c.Request.Context()), errRequestTimeout)
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// requestAuthKey is the gin context key of the requestAuth of a request
+// authenticated by its own credentials rather than a session.
+const requestAuthKey = "request_auth"
+
+// requestAuth is the caller of a request authenticated by a bearer token or
+// client certificate, and the clientset making requests on its behalf.
+type requestAuth struct {
+	id        identity
+	clientset kubernetes.Interface
+}
+
+// bearerAuth authenticates requests carrying an "Authorization: Bearer"
+// header, such as a CI job's service account token, without a session. The
+// token is resolved to a user and groups with a TokenReview, and the caller's
+// requests are then made with the token itself. Requests without the header
+// are passed through to the session checks.
+func (s *Server) bearerAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			c.Next()
+			return
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			respondError(c, http.StatusUnauthorized, codeUnauthenticated, "Empty bearer token")
+			return
+		}
+
+		auth, err := s.authenticateToken(c.Request.Context(), token)
+		if err != nil {
+			respondHTTPError(c, err)
+			return
+		}
+
+		c.Set(requestAuthKey, auth)
+		c.Next()
+	}
+}
+
+// authenticateToken resolves token to the identity it belongs to with a
+// TokenReview made with the application's own credentials.
+func (s *Server) authenticateToken(ctx context.Context, token string) (*requestAuth, *httpError) {
+	logger := requestLog(ctx)
+
+	reviewer, err := s.clientsets.Clientset("")
+	if err != nil {
+		logger.Error("Failed to create Kubernetes clientset", "error", err)
+		return nil, &httpError{http.StatusInternalServerError, codeInternal, "Failed to create Kubernetes clientset"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.APITimeout)
+	defer cancel()
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}
+	result, err := reviewer.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		logger.Error("Failed to create TokenReview", "error", err)
+		return nil, kubeAPIError(err, "Failed to review token")
+	}
+	if !result.Status.Authenticated {
+		logger.Warn("Bearer token rejected", "error", result.Status.Error)
+		return nil, &httpError{http.StatusUnauthorized, codeUnauthenticated, "Invalid bearer token"}
+	}
+
+	// Make the caller's requests with their own token, not our credentials
+	baseConfig, err := s.restConfig("")
+	if err != nil {
+		logger.Error("Failed to build Kubernetes client config", "error", err)
+		return nil, &httpError{http.StatusInternalServerError, codeInternal, "Failed to create Kubernetes clientset"}
+	}
+	tokenConfig := rest.AnonymousClientConfig(baseConfig)
+	tokenConfig.BearerToken = token
+
+	clientset, err := kubernetes.NewForConfig(tokenConfig)
+	if err != nil {
+		logger.Error("Failed to create Kubernetes clientset", "error", err)
+		return nil, &httpError{http.StatusInternalServerError, codeInternal, "Failed to create Kubernetes clientset"}
+	}
+
+	user := result.Status.User.Username
+	kind := rbacv1.UserKind
+	if _, _, ok := splitServiceAccountUsername(user); ok {
+		kind = rbacv1.ServiceAccountKind
+	}
+
+	return &requestAuth{
+		id: identity{
+			User:           user,
+			Groups:         result.Status.User.Groups,
+			Kind:           kind,
+			OwnCredentials: true,
+		},
+		clientset: clientset,
+	}, nil
+}
+
+// reviewSelf asks the API server who the user of the named context is
+// authenticated as, with a SelfSubjectReview. It reports false when that
+// can't be found out, such as on clusters older than 1.28.
+func (s *Server) reviewSelf(ctx context.Context, contextName string) (authenticationv1.UserInfo, bool) {
+	logger := requestLog(ctx)
+	clientset, err := s.clientsets.Clientset(contextName)
+	if err != nil {
+		logger.Warn("Failed to create Kubernetes clientset", "context", contextName, "error", err)
+		return authenticationv1.UserInfo{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.APITimeout)
+	defer cancel()
+
+	review, err := clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		logger.Warn("Failed to review the context's token, using the kubeconfig user name", "context", contextName, "error", err)
+		return authenticationv1.UserInfo{}, false
+	}
+	if review.Status.UserInfo.Username == "" {
+		return authenticationv1.UserInfo{}, false
+	}
+	return review.Status.UserInfo, true
+}
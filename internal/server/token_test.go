@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/biodigitalJaz/web-kubeauth/internal/kubeconfigtest"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// tokenContext is a context of the test kubeconfig whose user authenticates
+// with a bearer token.
+const tokenContext = "ci"
+
+// tokenContextServer returns a server whose tokenContext user authenticates
+// with token, against a fake cluster answering SelfSubjectReviews with
+// review.
+func tokenContextServer(t *testing.T, token string, review k8stesting.ReactionFunc) *Server {
+	t.Helper()
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectreviews", review)
+
+	cfg := testConfig(t, "viewer")
+	cfg.KubeConfigPath = writeKubeConfig(t,
+		[]kubeconfigtest.User{{Name: "ci-token", Token: token}},
+		[]kubeconfigtest.Context{{Name: tokenContext, Cluster: tokenContext, User: "ci-token"}},
+	)
+	return newTestServer(t, cfg, fakeClientsets{"": clientset, tokenContext: clientset})
+}
+
+func TestContextIdentityToken(t *testing.T) {
+	reviewedAs := func(username string, groups ...string) k8stesting.ReactionFunc {
+		return func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, &authenticationv1.SelfSubjectReview{
+				Status: authenticationv1.SelfSubjectReviewStatus{
+					UserInfo: authenticationv1.UserInfo{Username: username, Groups: groups},
+				},
+			}, nil
+		}
+	}
+	failing := func(err error) k8stesting.ReactionFunc {
+		return func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, err
+		}
+	}
+	notFound := apierrors.NewNotFound(authenticationv1.Resource("selfsubjectreviews"), "")
+
+	tests := []struct {
+		name       string
+		token      string
+		review     k8stesting.ReactionFunc
+		wantUser   string
+		wantGroups []string
+		wantKind   string
+	}{
+		{
+			name:       "token reviewed by the API server",
+			token:      "static-token",
+			review:     reviewedAs("alice@example.com", "system:authenticated", "developers"),
+			wantUser:   "alice@example.com",
+			wantGroups: []string{"system:authenticated", "developers"},
+			wantKind:   rbacv1.UserKind,
+		},
+		{
+			name:       "SelfSubjectReview not served",
+			token:      "static-token",
+			review:     failing(notFound),
+			wantUser:   "ci-token",
+			wantGroups: []string{"system:authenticated"},
+			wantKind:   rbacv1.UserKind,
+		},
+		{
+			name:       "review without a user",
+			token:      "static-token",
+			review:     reviewedAs(""),
+			wantUser:   "ci-token",
+			wantGroups: []string{"system:authenticated"},
+			wantKind:   rbacv1.UserKind,
+		},
+		{
+			name:       "service account token needs no review",
+			token:      testJWT(`{"sub":"system:serviceaccount:ci:deployer"}`),
+			review:     reviewedAs("someone-else"),
+			wantUser:   "system:serviceaccount:ci:deployer",
+			wantGroups: serviceAccountGroups("ci"),
+			wantKind:   rbacv1.ServiceAccountKind,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tokenContextServer(t, tt.token, tt.review)
+
+			id, err := s.contextIdentity(context.Background(), tokenContext)
+			if err != nil {
+				t.Fatalf("contextIdentity() failed: %s", err.Message)
+			}
+			if id.User != tt.wantUser || id.Kind != tt.wantKind || !slices.Equal(id.Groups, tt.wantGroups) {
+				t.Errorf("contextIdentity() = %s %v (%s), want %s %v (%s)", id.User, id.Groups, id.Kind, tt.wantUser, tt.wantGroups, tt.wantKind)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gin-contrib/sessions"
+	"gopkg.in/yaml.v2"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// userMapping maps the identities users log in with, such as an OIDC email,
+// to the user and group names the cluster's bindings use. It is read from
+// USER_MAPPING_FILE:
+//
+//	users:
+//	  - login: alice@example.com
+//	    user: alice
+//	    groups: [platform]
+//	groups:
+//	  - login: github:acme:platform
+//	    group: platform-admins
+//
+// A user rule renames the login to user, when set, and adds groups. A group
+// rule renames a login group. Logins and groups without a rule pass through
+// unchanged.
+type userMapping struct {
+	Users  []userMappingRule  `yaml:"users"`
+	Groups []groupMappingRule `yaml:"groups"`
+}
+
+// userMappingRule maps the login user Login.
+type userMappingRule struct {
+	Login  string   `yaml:"login"`
+	User   string   `yaml:"user"`
+	Groups []string `yaml:"groups"`
+}
+
+// groupMappingRule maps the login group Login.
+type groupMappingRule struct {
+	Login string `yaml:"login"`
+	Group string `yaml:"group"`
+}
+
+// loadUserMapping reads the user mapping file at path. It returns an empty
+// mapping, which passes every identity through, when path is empty.
+func loadUserMapping(path string) (*userMapping, error) {
+	mapping := &userMapping{}
+	if path == "" {
+		return mapping, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user mapping file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse user mapping file %s: %w", path, err)
+	}
+
+	for _, rule := range mapping.Users {
+		if rule.Login == "" {
+			return nil, fmt.Errorf("user mapping file %s has a user rule without a login", path)
+		}
+		if err := validateInput("mapped user", append([]string{rule.User}, rule.Groups...)...); err != nil {
+			return nil, fmt.Errorf("user mapping of %q: %s", rule.Login, err.Message)
+		}
+	}
+	for _, rule := range mapping.Groups {
+		if rule.Login == "" || rule.Group == "" {
+			return nil, fmt.Errorf("user mapping file %s has a group rule without a login or group", path)
+		}
+		if err := validateInput("mapped group", rule.Group); err != nil {
+			return nil, fmt.Errorf("group mapping of %q: %s", rule.Login, err.Message)
+		}
+	}
+	return mapping, nil
+}
+
+// apply returns id as the cluster knows it, matching logins with subjects.
+func (m *userMapping) apply(id identity, subjects subjectMatcher) identity {
+	mapped := id
+	mapped.Groups = make([]string, 0, len(id.Groups))
+	for _, group := range id.Groups {
+		for _, rule := range m.Groups {
+			if subjects.equal(rule.Login, group) {
+				group = rule.Group
+				break
+			}
+		}
+		mapped.Groups = append(mapped.Groups, group)
+	}
+
+	for _, rule := range m.Users {
+		if !subjects.equal(rule.Login, id.User) {
+			continue
+		}
+		if rule.User != "" {
+			mapped.User = rule.User
+			mapped.Kind = rbacv1.UserKind
+			if _, _, ok := splitServiceAccountUsername(rule.User); ok {
+				mapped.Kind = rbacv1.ServiceAccountKind
+			}
+		}
+		mapped.Groups = append(mapped.Groups, rule.Groups...)
+		break
+	}
+	return mapped
+}
+
+// loginIdentity returns the identity stored in the session, mapped to the
+// cluster's names. requestClient maps bearer token and client certificate
+// identities the same way.
+func (s *Server) loginIdentity(session sessions.Session) identity {
+	return s.userMapping.apply(sessionIdentity(session), s.subjects)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// hasControlChars reports whether value contains control characters or isn't
+// valid UTF-8. Such values never name a real kubeconfig entry or Kubernetes
+// subject, and would only turn up garbled in logs and comparisons.
+func hasControlChars(value string) bool {
+	return !utf8.ValidString(value) || strings.IndexFunc(value, unicode.IsControl) >= 0
+}
+
+// maxInputLength is the longest context name, user or group accepted, in
+// bytes. Kubernetes names are far shorter, and even long OIDC user names fit.
+const maxInputLength = 1024
+
+// validateInput returns a 400 error naming field when any of values contains
+// control characters or is longer than maxInputLength.
+func validateInput(field string, values ...string) *httpError {
+	for _, value := range values {
+		if hasControlChars(value) {
+			return &httpError{http.StatusBadRequest, codeBadRequest, fmt.Sprintf("The %s contains control characters.", field)}
+		}
+		if len(value) > maxInputLength {
+			return &httpError{http.StatusBadRequest, codeBadRequest, fmt.Sprintf("The %s is longer than %d bytes.", field, maxInputLength)}
+		}
+	}
+	return nil
+}
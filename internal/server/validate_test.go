@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "plain name", value: "dev-cluster"},
+		{name: "Unicode name", value: "équipe-données-東京"},
+		{name: "empty", value: ""},
+		{name: "longest accepted", value: strings.Repeat("a", maxInputLength)},
+		{name: "NUL", value: "dev\x00admin", wantErr: true},
+		{name: "newline", value: "dev\nadmin", wantErr: true},
+		{name: "escape sequence", value: "dev\x1b[31m", wantErr: true},
+		{name: "DEL", value: "dev\x7f", wantErr: true},
+		{name: "C1 control", value: "dev\u0085", wantErr: true},
+		{name: "invalid UTF-8", value: "dev\xff\xfe", wantErr: true},
+		{name: "truncated UTF-8", value: "\xe6\x9d", wantErr: true},
+		{name: "over-long", value: strings.Repeat("a", maxInputLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInput("context name", tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateInput(%q) = %v, want error %t", tt.value, err, tt.wantErr)
+			}
+			if err != nil && err.Status != http.StatusBadRequest {
+				t.Errorf("validateInput(%q) status = %d, want %d", tt.value, err.Status, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestValidateInputChecksEveryValue(t *testing.T) {
+	if err := validateInput("groups", "testers", "ops\x00", "admins"); err == nil {
+		t.Error("validateInput accepted a group with a NUL after a valid one")
+	}
+}
+
+func TestSelectContextControlChars(t *testing.T) {
+	s := newTestServer(t, testConfig(t, "viewer"), testClientsets(fake.NewSimpleClientset()))
+	client := newTestClient(t, s)
+
+	resp, body := client.postForm("/select-context", url.Values{"context": {testContext + "\x00"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("selecting a context with a NUL returned %d, want %d:\n%s", resp.StatusCode, http.StatusBadRequest, body)
+	}
+	if !strings.Contains(body, "control characters") {
+		t.Errorf("selecting a context with a NUL didn't report the control characters:\n%s", body)
+	}
+}
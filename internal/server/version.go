@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build metadata, set at link time with
+// -ldflags "-X github.com/biodigitalJaz/web-kubeauth/internal/server.Version=...".
+var (
+	Version   = "dev"
+	Commit    string
+	BuildDate string
+)
+
+// handleVersion reports which build is running, for checking rollouts.
+func (s *Server) handleVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":   Version,
+		"commit":    Commit,
+		"buildDate": BuildDate,
+		"goVersion": runtime.Version(),
+	})
+}
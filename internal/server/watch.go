@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// kubeConfigReloadDelay is how long to wait for a burst of file events, such
+// as an editor's save, to settle before reloading the kubeconfig.
+const kubeConfigReloadDelay = 250 * time.Millisecond
+
+// WatchKubeConfig reloads the kubeconfig whenever one of its files changes
+// until ctx is done, so new contexts show up without a restart. It does
+// nothing when running in-cluster.
+func (s *Server) WatchKubeConfig(ctx context.Context) error {
+	if s.inClusterConfig != nil {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create kubeconfig watcher: %w", err)
+	}
+
+	// Watch the directories rather than the files: editors often save by
+	// removing or renaming over the file, which would end a watch on it
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, path := range s.kubeConfigPaths {
+		path, err = filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		files[path] = true
+
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			slog.Warn("Failed to watch kubeconfig directory", "dir", dir, "error", err)
+			continue
+		}
+		dirs[dir] = true
+	}
+
+	// Every file of KUBECONFIG_DIR counts, including ones added later
+	var kubeConfigDir string
+	if s.cfg.KubeConfigDir != "" {
+		kubeConfigDir, err = filepath.Abs(s.cfg.KubeConfigDir)
+		if err == nil {
+			err = watcher.Add(kubeConfigDir)
+		}
+		if err != nil {
+			slog.Warn("Failed to watch kubeconfig directory", "dir", s.cfg.KubeConfigDir, "error", err)
+		}
+	}
+
+	go s.watchKubeConfig(ctx, watcher, files, kubeConfigDir)
+	return nil
+}
+
+// watchKubeConfig reloads the kubeconfig after events on any of files, or on
+// anything in dir when it is set.
+func (s *Server) watchKubeConfig(ctx context.Context, watcher *fsnotify.Watcher, files map[string]bool, dir string) {
+	defer watcher.Close()
+
+	reload := time.NewTimer(kubeConfigReloadDelay)
+	reload.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Clean(event.Name)
+			if files[name] || (dir != "" && filepath.Dir(name) == dir) {
+				reload.Reset(kubeConfigReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("Kubeconfig watcher failed", "error", err)
+		case <-reload.C:
+			s.handleKubeConfigChange()
+		}
+	}
+}
+
+// handleKubeConfigChange reloads the kubeconfig, keeping the current one when
+// the files are missing or invalid, such as halfway through a save.
+func (s *Server) handleKubeConfigChange() {
+	found, err := s.reloadKubeConfig()
+	if err != nil {
+		slog.Warn("Failed to reload kubeconfig, keeping the current one", "error", err)
+		return
+	}
+	if !found {
+		slog.Warn("Kubeconfig files removed, keeping the current one", "paths", s.kubeConfigPaths)
+		return
+	}
+
+	// Clientsets built from the old config may point at changed clusters
+	if cache, ok := s.clientsets.(*clientsetCache); ok {
+		cache.reset()
+	}
+	s.crbInformers.reset()
+	s.startDefaultInformer()
+
+	_, contexts := s.currentKubeConfig()
+	slog.Info("Reloaded kubeconfig", "contexts", len(contexts))
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// denyWebhookTimeout bounds each attempt to deliver a denial notification.
+const denyWebhookTimeout = 5 * time.Second
+
+// denyWebhookRetryDelay is the wait before the one retry of a failed delivery.
+const denyWebhookRetryDelay = time.Second
+
+// denyWebhookQueueSize is how many notifications may wait for delivery before
+// new ones are dropped, so a dead webhook can't pile up goroutines.
+const denyWebhookQueueSize = 100
+
+// denialEvent is the JSON payload POSTed to the deny webhook.
+type denialEvent struct {
+	User           string    `json:"user"`
+	Groups         []string  `json:"groups"`
+	Context        string    `json:"context,omitempty"`
+	Cluster        string    `json:"cluster,omitempty"`
+	ImpersonatedBy string    `json:"impersonatedBy,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+	RequiredRoles  []string  `json:"requiredRoles,omitempty"`
+	// RequiredBindings are ClusterRoleBinding names and RoleBinding
+	// namespace/names
+	RequiredBindings []string `json:"requiredBindings,omitempty"`
+	AccessVerb       string   `json:"accessVerb,omitempty"`
+	AccessResource   string   `json:"accessResource,omitempty"`
+	AccessAPIGroup   string   `json:"accessAPIGroup,omitempty"`
+	AccessNamespace  string   `json:"accessNamespace,omitempty"`
+	AccessName       string   `json:"accessName,omitempty"`
+}
+
+// denyWebhook notifies a security team's endpoint of denied access attempts.
+// Notifications are delivered in the background, one at a time, so a slow
+// endpoint never delays the response to the denied user.
+type denyWebhook struct {
+	url    string
+	client *http.Client
+	queue  chan denialEvent
+}
+
+// newDenyWebhook starts delivering notifications to url.
+func newDenyWebhook(url string) *denyWebhook {
+	w := &denyWebhook{
+		url:    url,
+		client: &http.Client{Timeout: denyWebhookTimeout},
+		queue:  make(chan denialEvent, denyWebhookQueueSize),
+	}
+	go w.run()
+	return w
+}
+
+// notify queues event for delivery, dropping it when the queue is full.
+func (w *denyWebhook) notify(event denialEvent) {
+	select {
+	case w.queue <- event:
+	default:
+		slog.Warn("Deny webhook queue is full, dropping notification", "user", event.User)
+	}
+}
+
+// run delivers queued notifications, retrying each once on failure.
+func (w *denyWebhook) run() {
+	for event := range w.queue {
+		err := w.post(event)
+		if err != nil {
+			time.Sleep(denyWebhookRetryDelay)
+			err = w.post(event)
+		}
+		if err != nil {
+			slog.Error("Failed to deliver deny webhook notification", "user", event.User, "error", err)
+		}
+	}
+}
+
+// post delivers event once.
+func (w *denyWebhook) post(event denialEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), denyWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyDenied reports id's denied access to the deny webhook, if configured.
+func (s *Server) notifyDenied(id identity) {
+	if s.denyWebhook == nil {
+		return
+	}
+
+	event := denialEvent{
+		User:           id.User,
+		Groups:         id.Groups,
+		Context:        id.Context,
+		Cluster:        id.Cluster,
+		ImpersonatedBy: id.ImpersonatedBy,
+		Timestamp:      time.Now().UTC(),
+	}
+	if s.cfg.AccessResource != "" {
+		event.AccessVerb = s.cfg.AccessVerb
+		event.AccessResource = s.cfg.AccessResource
+		event.AccessAPIGroup = s.cfg.AccessAPIGroup
+		event.AccessNamespace = s.cfg.AccessNamespace
+		event.AccessName = s.cfg.AccessName
+	} else {
+		event.RequiredRoles = s.cfg.RequiredRoles
+		event.RequiredBindings = s.cfg.RequiredBindings
+	}
+	s.denyWebhook.notify(event)
+}
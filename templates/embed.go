@@ -0,0 +1,10 @@
+// Package templates holds the HTML templates, embedded so the binary doesn't
+// need the templates directory next to it.
+package templates
+
+import "embed"
+
+// FS holds the HTML templates.
+//
+//go:embed *.html
+var FS embed.FS